@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"hitwicket/engine"
+)
+
+// handleAbort calls off a game started by mistake. Before the first move
+// either player can abort it; after that both must ask, with the AI always
+// agreeing. An aborted game has no winner and counts for nothing: it isn't
+// recorded on the leaderboard or in the match, and a match replays it. Must
+// be called with room.mu held.
+func (room *Room) handleAbort(playerID int) {
+	game := room.game
+	if !game.Started || game.GameOver || game.AbortRequested[playerID] {
+		return
+	}
+	game.AbortRequested[playerID] = true
+	room.logEvent("abort_request", playerID, "")
+	if config.AI {
+		game.AbortRequested[aiPlayer] = true
+	}
+	if game.MoveCount() > 0 && game.AbortRequested != [2]bool{true, true} {
+		return
+	}
+
+	log.Printf("Game in room %s aborted", room.ID)
+	game.EndGame(engine.NoWinner, engine.ReasonAborted)
+	room.cancelAI()
+	room.stopIdleClock()
+	room.logEvent("game_over", engine.NoWinner, engine.ReasonAborted)
+	if room.match != nil {
+		time.AfterFunc(time.Duration(config.RematchDelay), room.nextGame)
+	}
+	room.scheduleBroadcast()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"hitwicket/engine"
+)
+
+func TestAbortBeforeFirstMove(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGameWith(t, srv, "room=a&user=alice", "room=a&user=bob")
+	p1.send(Message{Action: "abort"})
+	state := p0.expectState(0)
+	for !state.GameOver {
+		state = p0.expectState(0)
+	}
+	if state.Winner != engine.NoWinner || state.GameOverReason != engine.ReasonAborted {
+		t.Fatalf("aborted game ended with winner %d by %q", state.Winner, state.GameOverReason)
+	}
+	if board, _ := store.Stats(); len(board) != 0 {
+		t.Fatalf("aborted game counted on the leaderboard: %+v", board)
+	}
+}
+
+func TestAbortAfterMoveNeedsBoth(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	p0.move("P1", "B")
+	p0.expectState(0)
+	p0.send(Message{Action: "abort"})
+
+	// One request isn't enough once a move has been made
+	p1.move("P1", "F")
+	if state := p0.expectState(0); state.GameOver {
+		t.Fatal("game aborted on one player's request after a move")
+	}
+	p1.send(Message{Action: "abort"})
+	state := p0.expectState(0)
+	for !state.GameOver {
+		state = p0.expectState(0)
+	}
+	if state.GameOverReason != engine.ReasonAborted {
+		t.Fatalf("game ended by %q, want aborted", state.GameOverReason)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// aiPlayer is the player the server controls when the AI is enabled
+const aiPlayer = 1
+
+// playAIMove starts the AI thinking about its move if it is the AI's turn.
+// The search runs on a copy of the game without holding the lock, and its
+// move is applied only if the search wasn't cancelled in the meantime. Must
+// be called with room.mu held.
+func (room *Room) playAIMove() {
+	game := room.game
+	if !config.AI || !game.Started || game.GameOver || game.Paused || game.CurrentPlayer != aiPlayer || room.aiCancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	room.aiCancel = cancel
+	search := game.Clone()
+	go func() {
+		searchCtx, stop := context.WithTimeout(ctx, time.Duration(config.AIMoveTime))
+		move, ok := search.ChooseAIMove(searchCtx, config.AIDepth)
+		stop()
+
+		room.mu.Lock()
+		defer room.mu.Unlock()
+		if ctx.Err() != nil {
+			log.Println("AI move discarded after its search was cancelled")
+			return
+		}
+		cancel()
+		room.aiCancel = nil
+		if !ok {
+			log.Println("AI has no legal move")
+			return
+		}
+		if err := game.ProcessMove(move, aiPlayer); err != nil {
+			log.Printf("AI move rejected: %v", err)
+			return
+		}
+		room.logMove(aiPlayer, fmt.Sprintf("%s %s", move.CharacterName, move.Direction))
+		room.moveApplied()
+		room.startIdleClock()
+		room.scheduleBroadcast()
+	}()
+}
+
+// cancelAI stops the AI's search, if any, so that its move is never applied.
+// Must be called with room.mu held.
+func (room *Room) cancelAI() {
+	if room.aiCancel != nil {
+		room.aiCancel()
+		room.aiCancel = nil
+	}
+}
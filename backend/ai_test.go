@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAIMoveDiscardedAfterResign(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) {
+		c.AI = true
+		c.AIDepth = 50
+		c.AIMoveTime = Duration(200 * time.Millisecond)
+	})
+	p0 := dial(t, srv, "room=a")
+	p0.expectState(0)
+	p0.send(Message{Action: "ready"})
+	for !p0.expectState(0).Started {
+	}
+
+	// The AI thinks without holding the room, so the resignation gets in
+	// before its move
+	p0.move("P1", "B")
+	p0.send(Message{Action: "resign"})
+	state := p0.expectState(0)
+	for !state.GameOver {
+		state = p0.expectState(0)
+	}
+	if state.Winner != aiPlayer {
+		t.Fatalf("game won by %d, want the AI", state.Winner)
+	}
+
+	time.Sleep(2 * time.Duration(config.AIMoveTime))
+	room := findRoom("a")
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if n := len(room.game.Moves); n != 1 {
+		t.Fatalf("game has %d moves once the search would have finished, want 1", n)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+	"slices"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+// AnnotationMessage tells the clients a player has commented on a move
+type AnnotationMessage struct {
+	Type      string `json:"type"`
+	MoveIndex int    `json:"move_index"`
+	engine.Comment
+}
+
+// handleAnnotate adds a player's comment to a move of the current game. A
+// comment on a finished game is saved to its stored record as well. Must be
+// called with room.mu held.
+func (room *Room) handleAnnotate(ws *websocket.Conn, index int, text string, playerID int) {
+	game := room.game
+	if err := game.Annotate(playerID, index, text); err != nil {
+		sendErrorFor(ws, err)
+		return
+	}
+	comments := game.Moves[index-game.Trimmed].Comments
+	comment := comments[len(comments)-1]
+	room.logEvent("annotate", playerID, comment.Text)
+
+	if room.record != nil && index < len(room.record.Moves) {
+		room.record.Moves[index].Comments = slices.Clone(comments)
+		if err := store.SaveGame(*room.record); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+
+	msg := AnnotationMessage{Type: "annotation", MoveIndex: index, Comment: comment}
+	for client, id := range room.clients {
+		if id == spectator && config.HideHistory && !game.GameOver {
+			continue
+		}
+		send := writeMessage
+		if id == spectator && config.SpectatorDelay > 0 {
+			send = room.sendDelayed
+		}
+		if err := send(client, msg); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+}
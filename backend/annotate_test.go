@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestAnnotateFinishedGame(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	p0.move("P1", "B")
+	p1.expectState(1)
+	p1.send(Message{Action: "resign"})
+	p0.expectGameOver()
+
+	p1.send(Message{Action: "annotate", MoveIndex: 0, Text: "should have seen it coming"})
+	var msg AnnotationMessage
+	p0.expect("annotation", &msg)
+	if msg.MoveIndex != 0 || msg.Player != 1 || msg.Text != "should have seen it coming" {
+		t.Fatalf("got annotation %+v", msg)
+	}
+
+	// The comment is saved with the finished game
+	records, err := store.ListGames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || len(records[0].Moves) != 1 || len(records[0].Moves[0].Comments) != 1 {
+		t.Fatalf("stored games %+v, want one with the comment on its move", records)
+	}
+
+	p0.send(Message{Action: "annotate", MoveIndex: 1, Text: "no such move"})
+	if got := p0.expectError(); got.Code != "no_such_move" {
+		t.Fatalf("comment on a move not played got error %+v", got)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/gorilla/websocket"
+)
+
+// stateChecksum hashes the board and player to move of a state as the client
+// receives it, so a client can check its own copy is in sync. The hash is
+// FNV-1a of every square in row order, written as . when empty or as the
+// owner followed by the piece name, each followed by a comma, and then the
+// player to move. It is sent as eight hex digits.
+func stateChecksum(state GameState) string {
+	h := fnv.New32a()
+	for _, row := range state.Board {
+		for _, char := range row {
+			if char == nil {
+				fmt.Fprint(h, ".")
+			} else {
+				fmt.Fprintf(h, "%d%s", char.Owner, char.Name)
+			}
+			fmt.Fprint(h, ",")
+		}
+	}
+	fmt.Fprintf(h, "%d", state.CurrentPlayer)
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// handleResync sends a client that found its checksum did not match the full
+// state, even if it is otherwise only sent patches. Must be called with
+// room.mu held.
+func (room *Room) handleResync(ws *websocket.Conn) {
+	delete(room.lastSent, ws)
+	room.sendGameState(ws)
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestStateChecksum(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	p0.move("P1", "B")
+	before := p1.expectState(0)
+	p1.move("P1", "F")
+	after := p1.expectState(0)
+	if after.Checksum != stateChecksum(after) || after.Checksum == before.Checksum {
+		t.Fatalf("checksums %s before and %s after the move, want %s after and a change", before.Checksum, after.Checksum, stateChecksum(after))
+	}
+}
+
+func TestResyncSendsFullState(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.StatePatches = true })
+	p0 := dial(t, srv, "room=a")
+	p0.expectState(0)
+	p1 := dial(t, srv, "room=a")
+	p1.expectState(0)
+	p0.send(Message{Action: "ready"})
+	p1.send(Message{Action: "ready"})
+	p0.expectPatch("/started", "true")
+	watcher := dial(t, srv, "room=a")
+	watcher.expect("state", nil)
+	p0.move("P1", "B")
+	watcher.expect("patch", nil)
+
+	for _, client := range []*testClient{p0, watcher} {
+		client.send(Message{Action: "resync"})
+		if state := client.expectState(0); len(state.Board) != 5 || state.Checksum != stateChecksum(state) {
+			t.Fatalf("resync sent %+v", state)
+		}
+	}
+}
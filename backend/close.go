@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Close codes the server disconnects clients with, from the range the
+// WebSocket protocol leaves to applications, so that a client can tell why it
+// was disconnected without parsing the reason text
+const (
+	// CloseTooManyConns: the client's address has too many connections open
+	CloseTooManyConns = 4000
+	// CloseThrottled: the user reconnected too often; retry after a backoff
+	CloseThrottled = 4001
+	// CloseDraining: the server is draining and takes no new games or
+	// players; connect to another server
+	CloseDraining = 4002
+	// CloseRoomFull: both player slots are taken and so are all the
+	// spectator places. It is only sent with MaxSpectators set above 0, as
+	// otherwise rooms take any number of spectators.
+	CloseRoomFull = 4003
+	// CloseAlreadyPlaying: the user already holds the other player slot
+	CloseAlreadyPlaying = 4004
+	// CloseKicked: the player sent too many invalid moves in a row, or the
+	// spectator was kicked by a player or an admin
+	CloseKicked = 4005
+	// CloseForfeit: the player was kicked and lost the game by forfeit
+	CloseForfeit = 4006
+	// CloseReplaced: the user connected again and the new connection took
+	// over
+	CloseReplaced = 4007
+	// CloseNoHeartbeat: the client stopped sending heartbeats
+	CloseNoHeartbeat = 4008
+	// CloseIdle: the client sent nothing for longer than the read timeout
+	CloseIdle = 4009
+	// CloseBanned: the user, or someone at their address, was kicked from the
+	// room and they may not watch it again until KickCooldown has passed
+	CloseBanned = 4010
+	// CloseAbandoned: both players left the game and the room was closed
+	CloseAbandoned = 4011
+	// CloseShutdown: the server is stopping; reconnect once it is back or to
+	// another server
+	CloseShutdown = 4012
+)
+
+// closeConn sends a client the close frame for why it is being disconnected.
+// The connection itself is left for its handler to close.
+func closeConn(ws *websocket.Conn, code int, reason string) {
+	closeMsg := websocket.FormatCloseMessage(code, reason)
+	ws.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+}
+
+// isTimeout reports whether a read failed because its deadline passed
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCloseCodesDistinct(t *testing.T) {
+	codes := map[string]int{
+		"too many connections": CloseTooManyConns,
+		"throttled":            CloseThrottled,
+		"draining":             CloseDraining,
+		"room full":            CloseRoomFull,
+		"already playing":      CloseAlreadyPlaying,
+		"kicked":               CloseKicked,
+		"forfeit":              CloseForfeit,
+		"replaced":             CloseReplaced,
+		"no heartbeat":         CloseNoHeartbeat,
+		"idle":                 CloseIdle,
+		"banned":               CloseBanned,
+		"abandoned":            CloseAbandoned,
+		"shutdown":             CloseShutdown,
+	}
+	seen := make(map[int]string)
+	for reason, code := range codes {
+		if code < 4000 || code > 4999 {
+			t.Errorf("%s closes with %d, outside the range left to applications", reason, code)
+		}
+		if other, ok := seen[code]; ok {
+			t.Errorf("%s and %s both close with %d", reason, other, code)
+		}
+		seen[code] = reason
+	}
+}
+
+func TestRoomFullAndIdleCloseCodes(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) {
+		c.MaxSpectators = 1
+		c.ReadTimeout = Duration(500 * time.Millisecond)
+	})
+	dial(t, srv, "room=a").expect("state", nil)
+	dial(t, srv, "room=a").expect("state", nil)
+	dial(t, srv, "room=a").expect("state", nil)
+	dial(t, srv, "room=a").expectClose(CloseRoomFull)
+	dial(t, srv, "room=b").expectClose(CloseIdle)
+}
+
+func TestShutdownClosesConns(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	watcher := dial(t, srv, "room=a")
+	watcher.expect("state", nil)
+	other := dial(t, srv, "room=b")
+	other.expect("state", nil)
+
+	closeAllConns()
+	for _, client := range []*testClient{p0, p1, watcher, other} {
+		client.expectClose(CloseShutdown)
+	}
+}
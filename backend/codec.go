@@ -0,0 +1,554 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// msgpackProtocol is the subprotocol a client offers to talk MessagePack
+// instead of JSON
+const msgpackProtocol = "hitwicket.v1.msgpack"
+
+// Codec turns messages into the bytes sent over a connection and back
+type Codec interface {
+	Encode(v any) ([]byte, error)
+	Decode(data []byte, v any) error
+	// MessageType is the WebSocket message type the encoding is sent as
+	MessageType() int
+}
+
+// codecFor returns the codec a connection negotiated through its subprotocol
+func codecFor(ws *websocket.Conn) Codec {
+	if ws.Subprotocol() == msgpackProtocol {
+		return msgpackCodec{}
+	}
+	return jsonCodec{}
+}
+
+// writeMessage encodes a message with the connection's codec and sends it
+func writeMessage(ws *websocket.Conn, v any) error {
+	codec := codecFor(ws)
+	data, err := codec.Encode(v)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(codec.MessageType(), data)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(v any) ([]byte, error)    { return json.Marshal(v) }
+func (jsonCodec) Decode(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) MessageType() int                { return websocket.TextMessage }
+
+// msgpackCodec encodes messages as MessagePack. Values are laid out as
+// encoding/json lays them out, so the field names and layout are exactly those
+// of the JSON protocol.
+type msgpackCodec struct{}
+
+func (msgpackCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeMsgpack(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Decode(data []byte, v any) error {
+	r := bytes.NewReader(data)
+	value, err := decodeMsgpack(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return errors.New("msgpack: trailing data after value")
+	}
+	data, err = json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	jsonNumberType    = reflect.TypeFor[json.Number]()
+)
+
+// encodeMsgpack writes a value as MessagePack, in the layout encoding/json
+// would give it: structs become maps keyed by their JSON field names and
+// types with a JSON encoding of their own are encoded from that
+func encodeMsgpack(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() || (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		buf.WriteByte(0xc0)
+		return nil
+	}
+	if v.Type().Implements(jsonMarshalerType) {
+		return encodeMsgpackMarshaler(buf, v.Interface().(json.Marshaler))
+	}
+	if v.Type() == jsonNumberType {
+		return encodeMsgpackNumber(buf, v.Interface().(json.Number))
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return encodeMsgpack(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		encodeMsgpackInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := v.Uint(); n > math.MaxInt64 {
+			buf.WriteByte(0xcf)
+			binary.Write(buf, binary.BigEndian, n)
+		} else {
+			encodeMsgpackInt(buf, int64(n))
+		}
+	case reflect.Float32, reflect.Float64:
+		encodeMsgpackFloat(buf, v.Float())
+	case reflect.String:
+		encodeMsgpackString(buf, v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// encoding/json sends byte slices as base64 strings
+			encodeMsgpackString(buf, base64.StdEncoding.EncodeToString(v.Bytes()))
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		encodeMsgpackLen(buf, v.Len(), 0x90, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeMsgpack(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		return encodeMsgpackMap(buf, v)
+	case reflect.Struct:
+		return encodeMsgpackStruct(buf, v)
+	default:
+		return fmt.Errorf("msgpack: cannot encode %s", v.Type())
+	}
+	return nil
+}
+
+// encodeMsgpackMarshaler writes a value from its own JSON encoding
+func encodeMsgpackMarshaler(buf *bytes.Buffer, m json.Marshaler) error {
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return err
+	}
+	return encodeMsgpack(buf, reflect.ValueOf(value))
+}
+
+// encodeMsgpackNumber writes a JSON number as an integer if it is one and as
+// a float otherwise
+func encodeMsgpackNumber(buf *bytes.Buffer, n json.Number) error {
+	if i, err := n.Int64(); err == nil {
+		encodeMsgpackInt(buf, i)
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	encodeMsgpackFloat(buf, f)
+	return nil
+}
+
+// encodeMsgpackFloat writes a float. Whole numbers are written as integers,
+// as encoding/json writes them without a fraction.
+func encodeMsgpackFloat(buf *bytes.Buffer, f float64) {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<63 && !(f == 0 && math.Signbit(f)) {
+		encodeMsgpackInt(buf, int64(f))
+		return
+	}
+	buf.WriteByte(0xcb)
+	binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+}
+
+func encodeMsgpackString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(s)
+}
+
+// encodeMsgpackMap writes a map with its keys turned into strings the way
+// encoding/json turns them, in sorted order
+func encodeMsgpackMap(buf *bytes.Buffer, v reflect.Value) error {
+	if v.IsNil() {
+		buf.WriteByte(0xc0)
+		return nil
+	}
+	keys := make([]string, 0, v.Len())
+	values := make(map[string]reflect.Value, v.Len())
+	for iter := v.MapRange(); iter.Next(); {
+		key, err := msgpackMapKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		values[key] = iter.Value()
+	}
+	sort.Strings(keys)
+	encodeMsgpackLen(buf, len(keys), 0x80, 0xde, 0xdf)
+	for _, key := range keys {
+		encodeMsgpackString(buf, key)
+		if err := encodeMsgpack(buf, values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// msgpackMapKey is the string encoding/json would use for a map key
+func msgpackMapKey(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+	if key.Type().Implements(textMarshalerType) {
+		text, err := key.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("msgpack: cannot encode map key of type %s", key.Type())
+}
+
+// encodeMsgpackStruct writes a struct as a map of its JSON fields
+func encodeMsgpackStruct(buf *bytes.Buffer, v reflect.Value) error {
+	fields := msgpackFields(v.Type())
+	names := make([]string, 0, len(fields))
+	values := make([]reflect.Value, 0, len(fields))
+	for _, field := range fields {
+		fv, err := v.FieldByIndexErr(field.index)
+		if err != nil {
+			// The field is in an embedded struct behind a nil pointer
+			continue
+		}
+		if field.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		names = append(names, field.name)
+		values = append(values, fv)
+	}
+	encodeMsgpackLen(buf, len(names), 0x80, 0xde, 0xdf)
+	for i, name := range names {
+		encodeMsgpackString(buf, name)
+		if err := encodeMsgpack(buf, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// msgpackField is a struct field as encoding/json sees it
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// msgpackFieldCache holds the fields of each struct type encoded so far
+var msgpackFieldCache sync.Map
+
+// msgpackFields lists the fields encoding/json would encode for a struct
+// type, following their json tags. The fields of embedded structs are
+// promoted, unless a field of the same name is embedded less deeply.
+func msgpackFields(t reflect.Type) []msgpackField {
+	if cached, ok := msgpackFieldCache.Load(t); ok {
+		return cached.([]msgpackField)
+	}
+
+	type candidate struct {
+		msgpackField
+		depth int
+	}
+	var all []candidate
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			fieldIndex := append(slices.Clone(index), i)
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					walk(ft, fieldIndex)
+					continue
+				}
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			all = append(all, candidate{
+				msgpackField: msgpackField{
+					name:      name,
+					index:     fieldIndex,
+					omitEmpty: slices.Contains(strings.Split(opts, ","), "omitempty"),
+				},
+				depth: len(fieldIndex),
+			})
+		}
+	}
+	walk(t, nil)
+
+	shallowest := make(map[string]int)
+	for _, c := range all {
+		if depth, ok := shallowest[c.name]; !ok || c.depth < depth {
+			shallowest[c.name] = c.depth
+		}
+	}
+	fields := make([]msgpackField, 0, len(all))
+	seen := make(map[string]bool)
+	for _, c := range all {
+		if c.depth == shallowest[c.name] && !seen[c.name] {
+			seen[c.name] = true
+			fields = append(fields, c.msgpackField)
+		}
+	}
+	msgpackFieldCache.Store(t, fields)
+	return fields
+}
+
+// isEmptyValue reports whether omitempty leaves a field out
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+func encodeMsgpackInt(buf *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n < 128:
+		buf.WriteByte(byte(n))
+	case n < 0 && n >= -32:
+		buf.WriteByte(byte(int8(n)))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// encodeMsgpackLen writes the header of an array or map, using the fix form
+// for fewer than 16 entries
+func encodeMsgpackLen(buf *bytes.Buffer, n int, fix, len16, len32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(len16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(len32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// decodeMsgpack reads a MessagePack value into the types JSON decodes to
+func decodeMsgpack(r *bytes.Reader) (any, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xe0 == 0xa0:
+		return readMsgpackString(r, int(b&0x1f))
+	case b&0xf0 == 0x90:
+		return readMsgpackArray(r, int(b&0x0f))
+	case b&0xf0 == 0x80:
+		return readMsgpackMap(r, int(b&0x0f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := readMsgpackUint(r, 1<<(b-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return float64(n), nil
+		}
+		return int64(n), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		n, err := readMsgpackUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend from the encoded width
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, nil
+	case 0xca:
+		n, err := readMsgpackUint(r, 4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 0xcb:
+		n, err := readMsgpackUint(r, 8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(n), nil
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		size := map[byte]int{0xd9: 1, 0xda: 2, 0xdb: 4, 0xc4: 1, 0xc5: 2, 0xc6: 4}[b]
+		n, err := readMsgpackUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackString(r, int(n))
+	case 0xdc, 0xdd:
+		n, err := readMsgpackUint(r, 2<<(b-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, int(n))
+	case 0xde, 0xdf:
+		n, err := readMsgpackUint(r, 2<<(b-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, int(n))
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", b)
+}
+
+// readMsgpackUint reads a big-endian unsigned integer of size bytes
+func readMsgpackUint(r *bytes.Reader, size int) (uint64, error) {
+	var n uint64
+	for i := 0; i < size; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n = n<<8 | uint64(b)
+	}
+	return n, nil
+}
+
+func readMsgpackString(r *bytes.Reader, n int) (string, error) {
+	if n > r.Len() {
+		return "", errors.New("msgpack: string runs past the end of the data")
+	}
+	data := make([]byte, n)
+	r.Read(data)
+	return string(data), nil
+}
+
+func readMsgpackArray(r *bytes.Reader, n int) ([]any, error) {
+	if n > r.Len() {
+		return nil, errors.New("msgpack: array runs past the end of the data")
+	}
+	items := make([]any, n)
+	for i := range items {
+		item, err := decodeMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+func readMsgpackMap(r *bytes.Reader, n int) (map[string]any, error) {
+	if n > r.Len() {
+		return nil, errors.New("msgpack: map runs past the end of the data")
+	}
+	m := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		key, err := decodeMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key %v is not a string", key)
+		}
+		value, err := decodeMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		m[name] = value
+	}
+	return m, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	msg := Message{
+		Action: "setup",
+		Move:   engine.Move{CharacterName: "H2", Direction: "B", Nonce: "n1"},
+		A:      strings.Repeat("long name ", 10),
+		Setup:  []engine.SetupPiece{{Type: "Pawn", X: 0, Y: 0}, {Type: "Hero1", X: 1, Y: 0}},
+	}
+	codec := msgpackCodec{}
+	data, err := codec.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Message
+	if err := codec.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, msg) {
+		t.Fatalf("decoded %+v, want %+v", decoded, msg)
+	}
+}
+
+func TestMsgpackMatchesJSON(t *testing.T) {
+	game := engine.NewGame(nil, engine.Rules{BoardWidth: 5, BoardHeight: 5, Pieces: []string{"Pawn", "Hero1"}})
+	for _, v := range []any{
+		GameState{Type: "state", Board: game.Board, Players: game.Players, Winner: engine.NoWinner, DrawOffers: []int{1}},
+		RoundMessage{Type: "round", Round: engine.Round{
+			Moves:   []engine.MoveRecord{{Player: 0, Character: "P1", Direction: "B", Captured: []string{"P3"}}},
+			Dropped: []engine.DroppedMove{{Player: 1, Move: engine.Move{CharacterName: "P1", Direction: "F"}, Reason: "blocked"}},
+		}},
+		RoomOptions{BoardWidth: 5, IdleLimit: Duration(time.Minute), TurnOrder: []int{1, 0}},
+		map[int]float64{2: 0.5, 10: 3},
+	} {
+		data, err := msgpackCodec{}.Encode(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fromMsgpack, fromJSON any
+		if err := (msgpackCodec{}).Decode(data, &fromMsgpack); err != nil {
+			t.Fatal(err)
+		}
+		jsonData, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(jsonData, &fromJSON); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fromMsgpack, fromJSON) {
+			t.Errorf("%T encoded as MessagePack holds %v, want its JSON form %v", v, fromMsgpack, fromJSON)
+		}
+	}
+}
+
+func TestMsgpackNonStringKey(t *testing.T) {
+	// A map of one entry whose key is the integer 1
+	data := []byte{0x81, 0x01, 0xa1, 'x'}
+	var v map[string]any
+	if err := (msgpackCodec{}).Decode(data, &v); err == nil {
+		t.Fatal("map with an integer key was decoded")
+	}
+}
+
+func TestMsgpackConnection(t *testing.T) {
+	srv := newTestServer(t, nil)
+	dialer := websocket.Dialer{Subprotocols: []string{msgpackProtocol}}
+	ws, _, err := dialer.Dial(wsURL(srv, "/ws?room=a"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	typ, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state GameState
+	if err := (msgpackCodec{}).Decode(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if typ != websocket.BinaryMessage || state.Type != "state" || len(state.Board) != 5 {
+		t.Fatalf("got message type %d holding %+v, want a binary state", typ, state)
+	}
+}
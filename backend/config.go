@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hitwicket/engine"
+)
+
+// Config holds the server settings. Values are read from an optional JSON
+// config file and then overridden by any flags given on the command line.
+type Config struct {
+	Addr              string   `json:"addr"`
+	AllowedOrigins    []string `json:"allowed_origins"`
+	RequireProtocol   bool     `json:"require_protocol"`
+	BoardWidth        int      `json:"board_width"`
+	BoardHeight       int      `json:"board_height"`
+	Pieces            []string `json:"pieces"`
+	Placement         string   `json:"placement"`
+	RandomPlacement   bool     `json:"random_placement"`
+	CustomSetup       bool     `json:"custom_setup"`
+	Seed              int64    `json:"seed"`
+	NonCapturing      []string `json:"non_capturing"`
+	HeroPush          bool     `json:"hero_push"`
+	NoHero2Jump       bool     `json:"no_hero2_jump"`
+	Guarding          bool     `json:"guarding"`
+	RespawnTurns      int      `json:"respawn_turns"`
+	King              string   `json:"king"`
+	RacePiece         string   `json:"race_piece"`
+	FirstCapture      bool     `json:"first_capture"`
+	Simultaneous      bool     `json:"simultaneous"`
+	KingSafety        bool     `json:"king_safety"`
+	BroadcastInterval Duration `json:"broadcast_interval"`
+	SpectatorInterval Duration `json:"spectator_interval"`
+	SpectatorDelay    Duration `json:"spectator_delay"`
+	MaxSpectators     int      `json:"max_spectators"`
+	AbandonGrace      Duration `json:"abandon_grace"`
+	ForfeitGrace      Duration `json:"forfeit_grace"`
+	IdleLimit         Duration `json:"idle_limit"`
+	FirstMoveBonus    Duration `json:"first_move_bonus"`
+	DrawOfferTimeout  Duration `json:"draw_offer_timeout"`
+	ClockTick         Duration `json:"clock_tick"`
+	MaxInvalidMoves   int      `json:"max_invalid_moves"`
+	Strict            bool     `json:"strict"`
+	NoTakeback        bool     `json:"no_takeback"`
+	DistinctPlayers   bool     `json:"distinct_players"`
+	UniqueNames       bool     `json:"unique_names"`
+	ReplaceConns      bool     `json:"replace_connections"`
+	KickCooldown      Duration `json:"kick_cooldown"`
+	ReplayInterval    Duration `json:"replay_interval"`
+	StatePatches      bool     `json:"state_patches"`
+	OrientBoards      bool     `json:"orient_boards"`
+	ShareSelection    bool     `json:"share_selection"`
+	TouchMove         bool     `json:"touch_move"`
+	HideIdentities    bool     `json:"anonymous_spectators"`
+	HideHistory       bool     `json:"hide_history"`
+	MaxMessageSize    int64    `json:"max_message_size"`
+	MaxConnsPerIP     int      `json:"max_conns_per_ip"`
+	MaxRoomsPerIP     int      `json:"max_rooms_per_ip"`
+	ReconnectBackoff  Duration `json:"reconnect_backoff"`
+	TrustForwardedFor bool     `json:"trust_forwarded_for"`
+	ReadTimeout       Duration `json:"read_timeout"`
+	HeartbeatTimeout  Duration `json:"heartbeat_timeout"`
+	EventLogSize      int      `json:"event_log_size"`
+	MaxHistory        int      `json:"max_history"`
+	Store             string   `json:"store"`
+	StoreDir          string   `json:"store_dir"`
+	AdminToken        string   `json:"admin_token"`
+	MaxMoves          int      `json:"max_moves"`
+	CaptureTiebreak   bool     `json:"capture_tiebreak"`
+	ImmobilizedLoses  bool     `json:"immobilized_loses"`
+	AllowSwap         bool     `json:"allow_swap"`
+	AllowPass         bool     `json:"allow_pass"`
+	MatchBestOf       int      `json:"match_best_of"`
+	RematchDelay      Duration `json:"rematch_delay"`
+	RematchOrder      string   `json:"rematch_order"`
+	AI                bool     `json:"ai"`
+	AIDepth           int      `json:"ai_depth"`
+	AIMoveTime        Duration `json:"ai_move_time"`
+
+	// DirectionAliases maps extra direction words clients may send to the
+	// direction tokens
+	DirectionAliases map[string]string `json:"direction_aliases"`
+
+	// PieceValues weights each piece type when counting material
+	PieceValues map[string]int `json:"piece_values"`
+}
+
+// Duration is a time.Duration that reads from JSON as a string like "50ms"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// listFlag is a flag.Value holding a comma-separated list
+type listFlag struct {
+	list *[]string
+}
+
+func (f listFlag) String() string {
+	if f.list == nil {
+		return ""
+	}
+	return strings.Join(*f.list, ",")
+}
+
+func (f listFlag) Set(value string) error {
+	*f.list = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*f.list = append(*f.list, item)
+		}
+	}
+	return nil
+}
+
+// mapFlag is a flag.Value holding comma-separated key=value pairs
+type mapFlag struct {
+	m *map[string]string
+}
+
+func (f mapFlag) String() string {
+	if f.m == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*f.m))
+	for key, value := range *f.m {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f mapFlag) Set(value string) error {
+	*f.m = make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("%q is not of the form key=value", item)
+		}
+		(*f.m)[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return nil
+}
+
+// intMapFlag is a flag.Value holding comma-separated key=number pairs
+type intMapFlag struct {
+	m *map[string]int
+}
+
+func (f intMapFlag) String() string {
+	if f.m == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*f.m))
+	for key, value := range *f.m {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f intMapFlag) Set(value string) error {
+	*f.m = make(map[string]int)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("%q is not of the form key=number", item)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil {
+			return fmt.Errorf("%q is not of the form key=number", item)
+		}
+		(*f.m)[strings.TrimSpace(key)] = n
+	}
+	return nil
+}
+
+var (
+	config = defaultConfig()
+
+	configPath = flag.String("config", "", "path to a JSON config file; flags override its values")
+)
+
+func init() {
+	flag.StringVar(&config.Addr, "addr", config.Addr, "address to listen on")
+	flag.Var(listFlag{&config.AllowedOrigins}, "origins", "comma-separated origins allowed to connect (empty allows any)")
+	flag.BoolVar(&config.RequireProtocol, "require-protocol", config.RequireProtocol, "reject clients that don't offer a supported WebSocket subprotocol such as hitwicket.v1")
+	flag.IntVar(&config.BoardWidth, "board-width", config.BoardWidth, "number of columns on the board")
+	flag.IntVar(&config.BoardHeight, "board-height", config.BoardHeight, "number of rows on the board")
+	flag.Var(listFlag{&config.Pieces}, "pieces", "comma-separated piece types making up each player's home row")
+	flag.Var(mapFlag{&config.DirectionAliases}, "direction-aliases", "comma-separated alias=direction pairs accepted in place of the direction tokens, e.g. up=F,down=B")
+	flag.Var(intMapFlag{&config.PieceValues}, "piece-values", "comma-separated type=value pairs weighting each piece type when counting material, e.g. Pawn=1,Hero1=3")
+	flag.StringVar(&config.Placement, "placement", config.Placement, "where the pieces start on the home row: left, center, or comma-separated columns counting from 0")
+	flag.BoolVar(&config.RandomPlacement, "random-placement", config.RandomPlacement, "shuffle the order of each player's home row")
+	flag.BoolVar(&config.CustomSetup, "custom-setup", config.CustomSetup, "let players arrange their own home row before the game starts")
+	flag.Int64Var(&config.Seed, "seed", config.Seed, "seed for random piece placement (0 picks one per room)")
+	flag.Var(listFlag{&config.NonCapturing}, "non-capturing", "comma-separated piece types that are blocked by an enemy instead of capturing it")
+	flag.BoolVar(&config.HeroPush, "hero-push", config.HeroPush, "let heroes push a friendly piece on their landing square one square further instead of being blocked")
+	flag.BoolVar(&config.NoHero2Jump, "no-hero2-jump", config.NoHero2Jump, "block Hero2 by a friendly piece on the square straight ahead or behind it that it passes, instead of letting it jump")
+	flag.BoolVar(&config.Guarding, "guarding", config.Guarding, "make a piece with a friendly piece directly behind it, as seen from the attacker, immune to capture")
+	flag.IntVar(&config.RespawnTurns, "respawn-turns", config.RespawnTurns, "return captured pieces to a free square of their home row after this many moves (0 captures them for good)")
+	flag.StringVar(&config.King, "king", config.King, "piece type acting as each player's king, whose capture wins the game (empty disables the king variant)")
+	flag.BoolVar(&config.Simultaneous, "simultaneous", config.Simultaneous, "have both players move at once each round")
+	flag.BoolVar(&config.FirstCapture, "first-capture", config.FirstCapture, "end the game with a win for the first player to capture a piece")
+	flag.StringVar(&config.RacePiece, "race-piece", config.RacePiece, "turn off captures and have the first player to get a piece of this type onto the opponent's home row win (empty disables the race variant)")
+	flag.BoolVar(&config.KingSafety, "king-safety", config.KingSafety, "with a king, reject moves that leave the mover's king open to capture")
+	flag.DurationVar((*time.Duration)(&config.BroadcastInterval), "broadcast-interval", time.Duration(config.BroadcastInterval), "coalesce state broadcasts into one per interval (0 broadcasts every change immediately)")
+	flag.DurationVar((*time.Duration)(&config.SpectatorInterval), "spectator-interval", time.Duration(config.SpectatorInterval), "send spectators at most one state update per interval (0 sends them every update players get)")
+	flag.DurationVar((*time.Duration)(&config.SpectatorDelay), "spectator-delay", time.Duration(config.SpectatorDelay), "show spectators the game this far behind the players (0 shows it live)")
+	flag.IntVar(&config.MaxSpectators, "max-spectators", config.MaxSpectators, "maximum spectators watching one room (0 disables)")
+	flag.DurationVar((*time.Duration)(&config.AbandonGrace), "abandon-grace", time.Duration(config.AbandonGrace), "how long a started game survives with no connected players before it is abandoned")
+	flag.Int64Var(&config.MaxMessageSize, "max-message-size", config.MaxMessageSize, "close connections that send a message larger than this many bytes")
+	flag.IntVar(&config.MaxConnsPerIP, "max-conns-per-ip", config.MaxConnsPerIP, "maximum concurrent connections from one client address (0 disables)")
+	flag.IntVar(&config.MaxRoomsPerIP, "max-rooms-per-ip", config.MaxRoomsPerIP, "maximum open rooms one client address can have created through POST /rooms (0 disables)")
+	flag.DurationVar((*time.Duration)(&config.ReconnectBackoff), "reconnect-backoff", time.Duration(config.ReconnectBackoff), "refuse a user reconnecting sooner than this after their last connection, doubling with each reconnect in a row (0 disables)")
+	flag.BoolVar(&config.TrustForwardedFor, "trust-forwarded-for", config.TrustForwardedFor, "take the client address from X-Forwarded-For, for running behind a proxy")
+	flag.DurationVar((*time.Duration)(&config.ReadTimeout), "read-timeout", time.Duration(config.ReadTimeout), "close connections that send nothing for this long (0 disables)")
+	flag.DurationVar((*time.Duration)(&config.HeartbeatTimeout), "heartbeat-timeout", time.Duration(config.HeartbeatTimeout), "disconnect clients that send no heartbeat action for this long (0 disables)")
+	flag.DurationVar((*time.Duration)(&config.ForfeitGrace), "forfeit-grace", time.Duration(config.ForfeitGrace), "how long a player may stay disconnected from a started game before forfeiting (0 disables)")
+	flag.DurationVar((*time.Duration)(&config.IdleLimit), "idle-limit", time.Duration(config.IdleLimit), "total time a player may spend on their turns over a game before forfeiting (0 disables)")
+	flag.DurationVar((*time.Duration)(&config.DrawOfferTimeout), "draw-offer-timeout", time.Duration(config.DrawOfferTimeout), "withdraw a draw offer the opponent hasn't answered after this long (0 keeps it until they move)")
+	flag.DurationVar((*time.Duration)(&config.FirstMoveBonus), "first-move-bonus", time.Duration(config.FirstMoveBonus), "extra time for the first move of a game, not counted towards the idle limit")
+	flag.DurationVar((*time.Duration)(&config.ClockTick), "clock-tick", time.Duration(config.ClockTick), "how often to send clients the time left on each idle clock while one is running (0 disables)")
+	flag.IntVar(&config.EventLogSize, "event-log-size", config.EventLogSize, "how many recent events each room keeps for /rooms/{id}/events")
+	flag.IntVar(&config.MaxHistory, "max-history", config.MaxHistory, "keep at most this many of a game's moves in memory, saving older ones to the store (0 keeps them all)")
+	flag.StringVar(&config.Store, "store", config.Store, "where to keep finished games and the leaderboard: memory, or file to keep them across restarts")
+	flag.StringVar(&config.StoreDir, "store-dir", config.StoreDir, "directory the file store writes to")
+	flag.StringVar(&config.AdminToken, "admin-token", config.AdminToken, "bearer token for the admin endpoints (empty disables them)")
+	flag.IntVar(&config.MaxInvalidMoves, "max-invalid-moves", config.MaxInvalidMoves, "disconnect a client after this many invalid moves in a row (0 disables)")
+	flag.BoolVar(&config.Strict, "strict", config.Strict, "forfeit the game of a player disconnected for sending invalid moves, and reject moves that leave the board unchanged")
+	flag.BoolVar(&config.NoTakeback, "no-takeback", config.NoTakeback, "reject a move taking a piece straight back to where it came from on the player's previous move")
+	flag.BoolVar(&config.AI, "ai", config.AI, "have the server play the second player")
+	flag.IntVar(&config.AIDepth, "ai-depth", config.AIDepth, "how many moves ahead the AI searches")
+	flag.DurationVar((*time.Duration)(&config.AIMoveTime), "ai-move-time", time.Duration(config.AIMoveTime), "longest the AI may think about a move")
+	flag.IntVar(&config.MatchBestOf, "best-of", config.MatchBestOf, "play each room as a best-of-N match instead of a single game")
+	flag.DurationVar((*time.Duration)(&config.RematchDelay), "rematch-delay", time.Duration(config.RematchDelay), "pause between the games of a match")
+	flag.StringVar(&config.RematchOrder, "rematch-order", config.RematchOrder, "who moves first in the next game of a match: swap, keep or random")
+	flag.IntVar(&config.MaxMoves, "max-moves", config.MaxMoves, "end the game once this many moves have been played in total (0 disables)")
+	flag.BoolVar(&config.ImmobilizedLoses, "immobilized-loses", config.ImmobilizedLoses, "make a player whose pieces can never move again lose, rather than draw by stalemate")
+	flag.BoolVar(&config.CaptureTiebreak, "capture-tiebreak", config.CaptureTiebreak, "award a game that reaches the move limit to the player with more captures")
+	flag.BoolVar(&config.AllowSwap, "allow-swap", config.AllowSwap, "let each player swap two adjacent pieces once per game instead of moving")
+	flag.BoolVar(&config.AllowPass, "allow-pass", config.AllowPass, "let players pass their turn instead of moving")
+	flag.BoolVar(&config.StatePatches, "state-patches", config.StatePatches, "send clients JSON Patches against their last state instead of the full state")
+	flag.BoolVar(&config.OrientBoards, "orient-boards", config.OrientBoards, "show the second player the board mirrored so their pieces start at the top, with directions to match")
+	flag.BoolVar(&config.ShareSelection, "share-selection", config.ShareSelection, "show the opponent, as well as spectators, which piece the player to move has selected")
+	flag.BoolVar(&config.TouchMove, "touch-move", config.TouchMove, "make a player move the first piece they select that has a legal move")
+	flag.BoolVar(&config.HideIdentities, "anonymous-spectators", config.HideIdentities, "hide player names and user IDs from spectators")
+	flag.BoolVar(&config.HideHistory, "hide-history", config.HideHistory, "hide the moves from spectators until the game is over")
+	flag.BoolVar(&config.DistinctPlayers, "distinct-players", config.DistinctPlayers, "reject a user ID from taking both player slots")
+	flag.BoolVar(&config.UniqueNames, "unique-names", config.UniqueNames, "reject a player name the opponent already goes by")
+	flag.DurationVar((*time.Duration)(&config.KickCooldown), "kick-cooldown", time.Duration(config.KickCooldown), "how long a kicked spectator is kept from rejoining the room")
+	flag.DurationVar((*time.Duration)(&config.ReplayInterval), "replay-interval", time.Duration(config.ReplayInterval), "time between the moves of a replay played at normal speed")
+	flag.BoolVar(&config.ReplaceConns, "replace-connections", config.ReplaceConns, "when a user connects again while still connected, hand their slot to the new connection and close the old one")
+}
+
+func defaultConfig() Config {
+	return Config{
+		Addr:        ":8080",
+		BoardWidth:  5,
+		BoardHeight: 5,
+		Pieces:      []string{"Pawn", "Hero1", "Pawn", "Hero2", "Pawn"},
+		DirectionAliases: map[string]string{
+			"left":     "L",
+			"right":    "R",
+			"up":       "F",
+			"forward":  "F",
+			"down":     "B",
+			"back":     "B",
+			"backward": "B",
+		},
+		PieceValues: map[string]int{
+			"Pawn":  1,
+			"Hero1": 3,
+			"Hero2": 3,
+		},
+		AbandonGrace:    Duration(time.Minute),
+		KickCooldown:    Duration(5 * time.Minute),
+		ReplayInterval:  Duration(time.Second),
+		ClockTick:       Duration(time.Second),
+		Store:           "memory",
+		StoreDir:        "data",
+		MaxInvalidMoves: 20,
+		MaxMessageSize:  4096,
+		MaxRoomsPerIP:   10,
+		EventLogSize:    256,
+		MatchBestOf:     1,
+		RematchDelay:    Duration(3 * time.Second),
+		RematchOrder:    rematchSwap,
+		AIDepth:         3,
+		AIMoveTime:      Duration(time.Second),
+	}
+}
+
+// parseConfig parses the command line into config, loading the config file
+// first if one is given so that flags take precedence over it.
+func parseConfig(args []string) error {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return err
+	}
+	if *configPath != "" {
+		if err := loadConfigFile(*configPath, &config); err != nil {
+			return err
+		}
+		// Parse again so flags override the file
+		if err := flag.CommandLine.Parse(args); err != nil {
+			return err
+		}
+	}
+	return config.validate()
+}
+
+func loadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	if err := c.roomOptions().validate(c.King); err != nil {
+		return err
+	}
+	if c.MatchBestOf < 1 || c.MatchBestOf%2 == 0 {
+		return errors.New("best-of must be a positive odd number")
+	}
+	if c.AIDepth < 1 {
+		return errors.New("AI depth must be at least 1")
+	}
+	if c.MaxMessageSize <= 0 {
+		return errors.New("max message size must be positive")
+	}
+	if c.MaxHistory != 0 && c.MaxHistory < engine.MinHistory {
+		return fmt.Errorf("max history must be 0 or at least %d", engine.MinHistory)
+	}
+	if c.ReplayInterval <= 0 {
+		return errors.New("replay interval must be positive")
+	}
+	switch c.Store {
+	case "memory", "file":
+	default:
+		return fmt.Errorf("unknown store: %s", c.Store)
+	}
+	switch c.RematchOrder {
+	case rematchSwap, rematchKeep, rematchRandom:
+	default:
+		return fmt.Errorf("unknown rematch order: %s", c.RematchOrder)
+	}
+	if c.KingSafety && c.King == "" {
+		return errors.New("king safety needs a king")
+	}
+	for charType := range c.PieceValues {
+		switch charType {
+		case "Pawn", "Hero1", "Hero2":
+		default:
+			return fmt.Errorf("piece value given for unknown piece type: %s", charType)
+		}
+	}
+	for alias, direction := range c.DirectionAliases {
+		if !slices.Contains(engine.Directions, direction) {
+			return fmt.Errorf("direction alias %s maps to unknown direction %s", alias, direction)
+		}
+	}
+	return nil
+}
+
+// checkOrigin allows any origin unless the config restricts them
+func checkOrigin(origin string) bool {
+	if len(config.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, allowed := range config.AllowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigFileWithFlagOverrides(t *testing.T) {
+	saved := config
+	t.Cleanup(func() {
+		config = saved
+		*configPath = ""
+	})
+	config = defaultConfig()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"board_width": 7, "max_invalid_moves": 3, "abandon_grace": "2s"}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseConfig([]string{"-config", path, "-board-width", "6"}); err != nil {
+		t.Fatal(err)
+	}
+	if config.BoardWidth != 6 {
+		t.Errorf("board width %d, want the flag's 6 over the file's 7", config.BoardWidth)
+	}
+	if config.MaxInvalidMoves != 3 || config.AbandonGrace != Duration(2*time.Second) {
+		t.Errorf("got max invalid moves %d and abandon grace %s from the file, want 3 and 2s", config.MaxInvalidMoves, time.Duration(config.AbandonGrace))
+	}
+	if config.BoardHeight != 5 {
+		t.Errorf("board height %d, want the default 5", config.BoardHeight)
+	}
+}
+
+func TestConfigFileInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"abandon_grace": "soon"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := defaultConfig()
+	if err := loadConfigFile(path, &cfg); err == nil {
+		t.Fatal("config file with a malformed duration was accepted")
+	}
+}
+
+func TestPieceValuesFlag(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+	config = defaultConfig()
+
+	if err := parseConfig([]string{"-piece-values", "Pawn=2, Hero1=4"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.PieceValues) != 2 || config.PieceValues["Pawn"] != 2 || config.PieceValues["Hero1"] != 4 {
+		t.Fatalf("got piece values %v, want Pawn=2 and Hero1=4", config.PieceValues)
+	}
+
+	cfg := defaultConfig()
+	cfg.PieceValues = map[string]int{"Queen": 9}
+	if err := cfg.validate(); err == nil {
+		t.Fatal("value for an unknown piece type was accepted")
+	}
+}
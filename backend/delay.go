@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// delayedMessage is an encoded message waiting to be sent to a spectator
+type delayedMessage struct {
+	due         time.Time
+	messageType int
+	data        []byte
+}
+
+// sendDelayed queues a message for a spectator, to be sent once the spectator
+// delay has passed. The message is encoded straight away so that it shows the
+// game as it is now. Must be called with room.mu held.
+func (room *Room) sendDelayed(client *websocket.Conn, msg any) error {
+	codec := codecFor(client)
+	data, err := codec.Encode(msg)
+	if err != nil {
+		return err
+	}
+	if room.delayed == nil {
+		room.delayed = make(map[*websocket.Conn][]delayedMessage)
+	}
+	queue := room.delayed[client]
+	room.delayed[client] = append(queue, delayedMessage{
+		due:         time.Now().Add(time.Duration(config.SpectatorDelay)),
+		messageType: codec.MessageType(),
+		data:        data,
+	})
+	if len(queue) == 0 {
+		time.AfterFunc(time.Duration(config.SpectatorDelay), func() { room.flushDelayed(client) })
+	}
+	return nil
+}
+
+// flushDelayed sends a spectator the queued messages that are due, in the
+// order they were queued, and waits for the next one if any are left
+func (room *Room) flushDelayed(client *websocket.Conn) {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if _, ok := room.clients[client]; !ok {
+		delete(room.delayed, client)
+		return
+	}
+
+	queue := room.delayed[client]
+	now := time.Now()
+	for len(queue) > 0 && !queue[0].due.After(now) {
+		if err := client.WriteMessage(queue[0].messageType, queue[0].data); err != nil {
+			log.Printf("error: %v", err)
+			room.dropClient(client)
+			return
+		}
+		queue = queue[1:]
+	}
+	if len(queue) == 0 {
+		delete(room.delayed, client)
+		return
+	}
+	room.delayed[client] = queue
+	time.AfterFunc(time.Until(queue[0].due), func() { room.flushDelayed(client) })
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpectatorDelay(t *testing.T) {
+	delay := 200 * time.Millisecond
+	srv := newTestServer(t, func(c *Config) { c.SpectatorDelay = Duration(delay) })
+	p0, _ := startGame(t, srv, "room=a")
+	watcher := dial(t, srv, "room=a")
+	watcher.expect("state", nil)
+
+	moved := time.Now()
+	p0.move("P1", "B")
+	p0.expectState(0)
+	if state := watcher.expectState(0); state.CurrentPlayer != 1 {
+		t.Fatalf("spectator's next state has player %d to move, want the move's", state.CurrentPlayer)
+	}
+	if elapsed := time.Since(moved); elapsed < delay {
+		t.Fatalf("spectator saw the move after %s, want at least %s", elapsed, delay)
+	}
+}
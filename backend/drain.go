@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// draining is set while the server is being drained for a deploy. New rooms
+// and new players are turned away, but games already under way carry on and
+// their players may reconnect.
+var draining atomic.Bool
+
+// isReconnect reports whether a user is returning to a game they were
+// already playing. Players who joined without a user ID cannot be told apart
+// from newcomers. Must be called with room.mu held.
+func (room *Room) isReconnect(userID string) bool {
+	if userID == "" || !room.game.Started || room.game.GameOver {
+		return false
+	}
+	for _, player := range room.game.Players {
+		if player.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// handleReadyz reports whether the server is taking new games, for load
+// balancers to stop routing to it while it drains
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ready")
+}
+
+// authorizeAdmin reports whether a request carries the admin token as a
+// bearer token, answering it if it doesn't. With no admin token configured,
+// the admin endpoints don't exist.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if config.AdminToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// handleDrain starts draining the server on PUT and stops it on DELETE. It
+// needs the admin token as a bearer token, and is disabled if none is
+// configured.
+func handleDrain(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	draining.Store(r.Method == http.MethodPut)
+	log.Printf("Draining: %v", draining.Load())
+	w.WriteHeader(http.StatusNoContent)
+}
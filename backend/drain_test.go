@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// adminRequest sends a request to an admin endpoint with token as its bearer
+// token, returning the response status
+func adminRequest(t *testing.T, srv *httptest.Server, method, path, token string) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestDrain(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.AdminToken = "secret" })
+	alice, _ := startGameWith(t, srv, "room=a&user=alice", "room=a&user=bob")
+	if status := adminRequest(t, srv, http.MethodPut, "/admin/drain", "wrong"); status != http.StatusUnauthorized {
+		t.Fatalf("drain with the wrong token got %d", status)
+	}
+	if status := adminRequest(t, srv, http.MethodPut, "/admin/drain", "secret"); status != http.StatusNoContent {
+		t.Fatalf("drain got %d", status)
+	}
+	if status := adminRequest(t, srv, http.MethodGet, "/readyz", ""); status != http.StatusServiceUnavailable {
+		t.Fatalf("readyz while draining got %d", status)
+	}
+
+	// New rooms are turned away, but the game under way carries on
+	dial(t, srv, "room=b").expectClose(CloseDraining)
+	alice.ws.Close()
+	waitFor(t, func() bool { return !connected("a")[0] })
+	alice = dial(t, srv, "room=a&user=alice")
+	alice.move("P1", "B")
+	alice.expectState(1)
+
+	if status := adminRequest(t, srv, http.MethodDelete, "/admin/drain", "secret"); status != http.StatusNoContent {
+		t.Fatalf("undrain got %d", status)
+	}
+	dial(t, srv, "room=b").expect("state", nil)
+}
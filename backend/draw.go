@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+// DrawOfferMessage tells the clients a player has offered a draw
+type DrawOfferMessage struct {
+	Type   string `json:"type"`
+	Player int    `json:"player"`
+}
+
+// handleOfferDraw offers the opponent a draw. The offer stands until the
+// opponent accepts it, declines it by moving, or it times out. Two players
+// offering each other a draw agree to one. The AI never accepts. Must be
+// called with room.mu held.
+func (room *Room) handleOfferDraw(playerID int) {
+	game := room.game
+	if !game.Started || game.GameOver || game.DrawOffered[playerID] {
+		return
+	}
+	if game.DrawOffered[(playerID+1)%2] {
+		room.acceptDraw(playerID)
+		return
+	}
+	game.DrawOffered[playerID] = true
+	room.logEvent("draw_offer", playerID, "")
+	for client := range room.clients {
+		if err := writeMessage(client, DrawOfferMessage{Type: "draw_offer", Player: playerID}); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+
+	if config.DrawOfferTimeout > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(time.Duration(config.DrawOfferTimeout), func() {
+			room.mu.Lock()
+			defer room.mu.Unlock()
+			if room.game != game || room.drawTimers[playerID] != timer || !game.DrawOffered[playerID] || game.GameOver {
+				return
+			}
+			game.DrawOffered[playerID] = false
+			room.logEvent("draw_offer_expired", playerID, "")
+			room.scheduleBroadcast()
+		})
+		room.drawTimers[playerID] = timer
+	}
+	room.scheduleBroadcast()
+}
+
+// handleAcceptDraw accepts the draw the opponent offered. Must be called with
+// room.mu held.
+func (room *Room) handleAcceptDraw(ws *websocket.Conn, playerID int) {
+	game := room.game
+	if !game.Started || game.GameOver || !game.DrawOffered[(playerID+1)%2] {
+		sendError(ws, "no draw offer to accept")
+		return
+	}
+	room.acceptDraw(playerID)
+}
+
+// acceptDraw ends the game drawn by agreement. Must be called with room.mu
+// held.
+func (room *Room) acceptDraw(playerID int) {
+	log.Printf("Game in room %s drawn by agreement", room.ID)
+	room.logEvent("draw_accept", playerID, "")
+	room.game.DrawOffered = [2]bool{}
+	room.endGame(engine.NoWinner, engine.ReasonAgreement)
+}
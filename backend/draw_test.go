@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"hitwicket/engine"
+)
+
+func TestDrawAccepted(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	p1.send(Message{Action: "accept_draw"})
+	p1.expectError()
+
+	p0.send(Message{Action: "offer_draw"})
+	var offer DrawOfferMessage
+	p1.expect("draw_offer", &offer)
+	if offer.Player != 0 {
+		t.Fatalf("got a draw offer from player %d, want 0", offer.Player)
+	}
+	p1.send(Message{Action: "accept_draw"})
+	state := p0.expectGameOver()
+	if state.Winner != engine.NoWinner || state.GameOverReason != engine.ReasonAgreement {
+		t.Fatalf("game ended with winner %d by %q, want a draw by agreement", state.Winner, state.GameOverReason)
+	}
+}
+
+func TestDrawDeclinedByMoving(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	p0.move("P1", "B")
+	p1.expectState(1)
+	p0.send(Message{Action: "offer_draw"})
+	p1.expect("draw_offer", nil)
+
+	p1.move("P1", "F")
+	if state := p0.expectState(2); len(state.DrawOffers) != 0 {
+		t.Fatalf("draw offers %v stand after the opponent moved", state.DrawOffers)
+	}
+	p1.send(Message{Action: "accept_draw"})
+	p1.expectError()
+}
+
+func TestDrawOfferExpires(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.DrawOfferTimeout = Duration(100 * time.Millisecond) })
+	p0, p1 := startGame(t, srv, "room=a")
+	p0.send(Message{Action: "offer_draw"})
+	p1.expect("draw_offer", nil)
+	waitFor(t, func() bool {
+		room := findRoom("a")
+		room.mu.Lock()
+		defer room.mu.Unlock()
+		return !room.game.DrawOffered[0]
+	})
+	p1.send(Message{Action: "accept_draw"})
+	p1.expectError()
+}
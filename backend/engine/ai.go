@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+	"math"
+)
+
+// winScore outweighs any material difference so that won and lost positions
+// dominate the evaluation
+const winScore = 1000
+
+// ChooseAIMove searches the current position with iterative deepening up to
+// depth, returning the best move of the deepest search finished before ctx
+// is done. The search plays moves on the game and rolls them back.
+func (g *Game) ChooseAIMove(ctx context.Context, depth int) (Move, bool) {
+	moves := g.LegalMoves(g.CurrentPlayer)
+	if len(moves) == 0 {
+		return Move{}, false
+	}
+
+	best := moves[0]
+	for d := 1; d <= depth; d++ {
+		move, ok := g.searchRoot(ctx, moves, best, d)
+		if !ok {
+			break
+		}
+		best = move
+	}
+	return best, true
+}
+
+// searchRoot returns the best of moves at the given depth, trying the previous
+// best move first to tighten the alpha-beta window early. It reports false if
+// ctx was done before the search finished.
+func (g *Game) searchRoot(ctx context.Context, moves []Move, previous Move, depth int) (Move, bool) {
+	ordered := append([]Move{previous}, moves...)
+	best, alpha := previous, math.MinInt+1
+	for i, move := range ordered {
+		if i > 0 && move == previous {
+			continue
+		}
+		score, ok := g.searchMove(ctx, move, depth, alpha, math.MaxInt)
+		if !ok {
+			return Move{}, false
+		}
+		if score > alpha {
+			best, alpha = move, score
+		}
+	}
+	return best, true
+}
+
+// searchMove plays a move, scores the resulting position from the mover's
+// point of view and rolls the move back.
+func (g *Game) searchMove(ctx context.Context, move Move, depth, alpha, beta int) (int, bool) {
+	mover := g.CurrentPlayer
+	snap := g.takeSnapshot()
+	defer g.restoreSnapshot(snap)
+
+	if err := g.ProcessMove(move, mover); err != nil {
+		return math.MinInt + 1, true
+	}
+	score, ok := g.negamax(ctx, depth-1, -beta, -alpha)
+	return -score, ok
+}
+
+// negamax scores the position for the player to move using alpha-beta
+// pruning. It reports false if ctx was done before it finished.
+func (g *Game) negamax(ctx context.Context, depth, alpha, beta int) (int, bool) {
+	if ctx.Err() != nil {
+		return 0, false
+	}
+	if g.GameOver {
+		if g.Winner == NoWinner {
+			return 0, true
+		}
+		// Prefer quicker wins and slower losses
+		if g.Winner == g.CurrentPlayer {
+			return winScore + depth, true
+		}
+		return -winScore - depth, true
+	}
+	if depth == 0 {
+		return g.evaluate(g.CurrentPlayer), true
+	}
+
+	moves := g.LegalMoves(g.CurrentPlayer)
+	if len(moves) == 0 {
+		return g.evaluate(g.CurrentPlayer), true
+	}
+	for _, move := range moves {
+		score, ok := g.searchMove(ctx, move, depth, alpha, beta)
+		if !ok {
+			return 0, false
+		}
+		if score > alpha {
+			alpha = score
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	return alpha, true
+}
+
+// MaterialBalance returns Player 1's material minus Player 2's, counting
+// each surviving piece at the game's value for its type
+func (g *Game) MaterialBalance() int {
+	balance := 0
+	for _, char := range g.Players[0].Characters {
+		balance += g.Rules.PieceValues[char.Type]
+	}
+	for _, char := range g.Players[1].Characters {
+		balance -= g.Rules.PieceValues[char.Type]
+	}
+	return balance
+}
+
+// evaluate returns the material balance from a player's point of view
+func (g *Game) evaluate(playerID int) int {
+	if playerID == 1 {
+		return -g.MaterialBalance()
+	}
+	return g.MaterialBalance()
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAITakesFreePiece(t *testing.T) {
+	rules := testRules()
+	rules.PieceValues = map[string]int{"Pawn": 1, "Hero1": 3, "Hero2": 3}
+	g := newPosition(t, rules,
+		Character{Type: "Pawn", Name: "P1", X: 2, Y: 2, Owner: 0},
+		Character{Type: "Pawn", Name: "P3", X: 0, Y: 0, Owner: 0},
+		Character{Type: "Hero1", Name: "H2", X: 3, Y: 2, Owner: 1},
+		Character{Type: "Pawn", Name: "P5", X: 4, Y: 4, Owner: 1},
+	)
+	before := g.positionKey()
+	move, ok := g.ChooseAIMove(context.Background(), 3)
+	if !ok {
+		t.Fatal("AI found no move")
+	}
+	if move != (Move{CharacterName: "P1", Direction: "R"}) {
+		t.Errorf("AI chose %+v, want P1 R taking the hero", move)
+	}
+	if g.positionKey() != before || len(g.Moves) != 0 {
+		t.Error("the search left its moves on the board")
+	}
+}
+
+func TestAIStopsWhenCancelled(t *testing.T) {
+	g := newTestGame(testRules())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	move, ok := g.ChooseAIMove(ctx, 10)
+	if !ok || move != g.LegalMoves(0)[0] {
+		t.Fatalf("cancelled search returned %+v, %v, want the first legal move", move, ok)
+	}
+}
+
+func TestMaterialBalance(t *testing.T) {
+	rules := testRules()
+	rules.PieceValues = map[string]int{"Pawn": 1, "Hero1": 3, "Hero2": 5}
+	g := newPosition(t, rules,
+		Character{Type: "Hero2", Name: "H4", X: 3, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 0, Y: 0, Owner: 0},
+		Character{Type: "Hero1", Name: "H2", X: 1, Y: 4, Owner: 1},
+		Character{Type: "Pawn", Name: "P5", X: 4, Y: 4, Owner: 1},
+	)
+	if got := g.MaterialBalance(); got != 2 {
+		t.Fatalf("balance %d, want 6-4=2", got)
+	}
+	if g.evaluate(1) != -2 {
+		t.Fatalf("player 2 evaluates the position at %d, want -2", g.evaluate(1))
+	}
+}
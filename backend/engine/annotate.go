@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxCommentLength is the longest comment, in characters, Annotate accepts
+const MaxCommentLength = 200
+
+// Comment is a player's annotation on a move
+type Comment struct {
+	Player int    `json:"player"`
+	Text   string `json:"text"`
+}
+
+// Annotate adds a player's comment to the move at index in the game,
+// counting from 0. Moves can be annotated during the game and after it, but
+// not once trimmed from the history. The text may not contain braces or line
+// breaks, which would break the transcript.
+func (g *Game) Annotate(playerID, index int, text string) error {
+	if index < g.Trimmed || index >= g.MoveCount() {
+		return fmt.Errorf("%w: %d", ErrNoSuchMove, index)
+	}
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return fmt.Errorf("%w: empty", ErrInvalidComment)
+	case utf8.RuneCountInString(text) > MaxCommentLength:
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidComment, MaxCommentLength)
+	case strings.ContainsAny(text, "{}\r\n"):
+		return fmt.Errorf("%w: braces and line breaks are not allowed", ErrInvalidComment)
+	}
+	move := &g.Moves[index-g.Trimmed]
+	move.Comments = append(move.Comments, Comment{Player: playerID, Text: text})
+	return nil
+}
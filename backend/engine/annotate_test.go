@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAnnotate(t *testing.T) {
+	g := newTestGame(testRules())
+	mustMove(t, g, "P1", "B", 0)
+	mustMove(t, g, "P1", "F", 1)
+	if err := g.Annotate(1, 0, "  opens the left file "); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Annotate(0, 0, "thanks"); err != nil {
+		t.Fatal(err)
+	}
+	want := "1. P1-B {opens the left file} {thanks} P1-F *"
+	if got := g.Transcript("r"); !strings.Contains(got, want) {
+		t.Errorf("got transcript\n%s\nwant it to contain %q", got, want)
+	}
+
+	for _, bad := range []struct {
+		index int
+		text  string
+		want  error
+	}{
+		{2, "not played yet", ErrNoSuchMove},
+		{-1, "before the game", ErrNoSuchMove},
+		{1, " ", ErrInvalidComment},
+		{1, "a {brace}", ErrInvalidComment},
+		{1, "two\nlines", ErrInvalidComment},
+		{1, strings.Repeat("x", MaxCommentLength+1), ErrInvalidComment},
+	} {
+		if err := g.Annotate(0, bad.index, bad.text); !errors.Is(err, bad.want) {
+			t.Errorf("comment %q on move %d: got %v, want %v", bad.text, bad.index, err, bad.want)
+		}
+	}
+	if len(g.Moves[1].Comments) != 0 {
+		t.Errorf("rejected comments were added: %+v", g.Moves[1].Comments)
+	}
+}
@@ -0,0 +1,68 @@
+package engine
+
+import "errors"
+
+// Errors a rejected move, swap or pass wraps, so callers can tell why it was
+// rejected with errors.Is
+var (
+	ErrGameNotStarted    = errors.New("waiting for opponent")
+	ErrGamePaused        = errors.New("game is paused")
+	ErrNotYourTurn       = errors.New("not your turn")
+	ErrGameOver          = errors.New("game over")
+	ErrUnknownDirection  = errors.New("unknown direction")
+	ErrInvalidCharacter  = errors.New("invalid character")
+	ErrOutOfBounds       = errors.New("move leaves the board")
+	ErrBlockedByFriendly = errors.New("blocked by a friendly piece")
+	ErrBlockedByEnemy    = errors.New("blocked by an enemy piece it cannot capture")
+	ErrGuarded           = errors.New("target is guarded from behind")
+	ErrIllegalDirection  = errors.New("piece cannot move in that direction")
+	ErrNoEffect          = errors.New("move leaves the board unchanged")
+	ErrKingExposed       = errors.New("king left open to capture")
+	ErrTouchMove         = errors.New("you must move the piece you touched")
+	ErrTakeback          = errors.New("move undoes your previous move")
+	ErrNotAllowed        = errors.New("not allowed")
+	ErrAlreadySubmitted  = errors.New("move already submitted for this round")
+	ErrCollision         = errors.New("both pieces would land on the same square")
+	ErrOutOfSync         = errors.New("board and pieces out of sync")
+	ErrNoSuchMove        = errors.New("no such move")
+	ErrInvalidComment    = errors.New("invalid comment")
+)
+
+// errorCodes maps each error to the code sent with it in error messages
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrGameNotStarted, "not_started"},
+	{ErrGamePaused, "paused"},
+	{ErrNotYourTurn, "not_your_turn"},
+	{ErrGameOver, "game_over"},
+	{ErrUnknownDirection, "unknown_direction"},
+	{ErrInvalidCharacter, "invalid_character"},
+	{ErrOutOfBounds, "out_of_bounds"},
+	{ErrBlockedByFriendly, "blocked_by_friendly"},
+	{ErrBlockedByEnemy, "blocked_by_enemy"},
+	{ErrGuarded, "guarded"},
+	{ErrIllegalDirection, "illegal_direction"},
+	{ErrNoEffect, "no_effect"},
+	{ErrKingExposed, "king_exposed"},
+	{ErrTouchMove, "touch_move"},
+	{ErrTakeback, "takeback"},
+	{ErrNotAllowed, "not_allowed"},
+	{ErrAlreadySubmitted, "already_submitted"},
+	{ErrCollision, "collision"},
+	{ErrOutOfSync, "out_of_sync"},
+	{ErrNoSuchMove, "no_such_move"},
+	{ErrInvalidComment, "invalid_comment"},
+}
+
+// ErrorCode returns the protocol code for an error, or "" if it wraps none of
+// the known errors
+func ErrorCode(err error) string {
+	for _, entry := range errorCodes {
+		if errors.Is(err, entry.err) {
+			return entry.code
+		}
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMoveErrors(t *testing.T) {
+	tests := []struct {
+		move Move
+		want error
+	}{
+		{Move{CharacterName: "P1", Direction: "F"}, ErrOutOfBounds},
+		{Move{CharacterName: "H2", Direction: "F"}, ErrOutOfBounds},
+		{Move{CharacterName: "P1", Direction: "R"}, ErrBlockedByFriendly},
+		{Move{CharacterName: "Q9", Direction: "B"}, ErrInvalidCharacter},
+	}
+	for _, test := range tests {
+		g := newTestGame(testRules())
+		err := g.ProcessMove(test.move, 0)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s %s: got %v, want %v", test.move.CharacterName, test.move.Direction, err, test.want)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	wrapped := fmt.Errorf("invalid move: P1 F: %w", ErrOutOfBounds)
+	if code := ErrorCode(wrapped); code != "out_of_bounds" {
+		t.Errorf("wrapped error has code %q, want out_of_bounds", code)
+	}
+	if code := ErrorCode(errors.New("something else")); code != "" {
+		t.Errorf("unknown error has code %q, want none", code)
+	}
+}
@@ -0,0 +1,1200 @@
+// Package engine implements the rules of the game: the board, the pieces and
+// how they move, and how a game is won or drawn. It has no networking, so it
+// can be played from a server, a command line or a test alike.
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+// Game represents the game state
+type Game struct {
+	Board         [][]*Character
+	Players       [2]*Player
+	CurrentPlayer int
+	GameOver      bool
+	Winner        int
+	Ready         [2]bool
+	Started       bool
+
+	// FirstPlayer is the player who made, or will make, the first move
+	FirstPlayer int
+
+	// LastNonce is the nonce of each player's last applied move
+	LastNonce [2]string
+	SwapUsed  [2]bool
+
+	GameOverReason string
+
+	// PositionHistory holds a key for every position reached, for detecting
+	// repetition
+	PositionHistory []string
+
+	// Moves holds every move and swap played, in order, but for the first
+	// Trimmed, which TrimHistory has dropped
+	Moves   []MoveRecord
+	Trimmed int
+
+	// Start is where each player's pieces stood before the first move
+	Start [2][]Character
+
+	// Paused is set while both players have agreed to a break.
+	// PauseRequested and ResumeRequested record which players have asked so
+	// far.
+	Paused          bool
+	PauseRequested  [2]bool
+	ResumeRequested [2]bool
+
+	// AbortRequested records which players have asked to call the game off
+	AbortRequested [2]bool
+
+	// DrawOffered records which players have a draw offer standing. The
+	// opponent declines it by moving.
+	DrawOffered [2]bool
+
+	// Touched names the piece the player to move selected under touch-move
+	Touched string
+
+	// Respawns holds captured pieces waiting to return to their home row
+	Respawns []Respawn
+
+	// Pending holds the moves submitted for the current round of a
+	// simultaneous game
+	Pending [2]*Move
+
+	// Rules are the settings the game is played by
+	Rules Rules
+
+	// positionID identifies the current position and move history for the
+	// legal move cache. Every change to either gives it a value from
+	// lastPositionID that it has never had before, and rolling back a
+	// snapshot restores the one it had.
+	positionID     uint64
+	lastPositionID uint64
+
+	// legalCache holds each player's legal moves in the position legalKey
+	// identifies, so that everything asking between moves shares the work
+	legalKey   [2]uint64
+	legalCache [2][]Move
+
+	// trimmedPositions counts the positions trimmed with the moves that
+	// can still come up again, and trimmedCaptures the pieces those moves
+	// captured
+	trimmedPositions map[string]int
+	trimmedCaptures  [2][]CapturedPiece
+}
+
+// Respawn is a captured piece due back on the board once Turn moves have been
+// played in the game
+type Respawn struct {
+	Character *Character
+	Turn      int
+}
+
+// MoveRecord is an entry in a game's move history
+type MoveRecord struct {
+	Player    int    `json:"player"`
+	Character string `json:"character,omitempty"`
+	Piece     string `json:"piece,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	// Swap names the piece a swap exchanged Character with
+	Swap     string   `json:"swap,omitempty"`
+	Captured []string `json:"captured,omitempty"`
+	// CapturedTypes are the types of the Captured pieces, in the same order
+	CapturedTypes []string `json:"captured_types,omitempty"`
+	// MultiCapture is set for a hero move capturing on its path and on its
+	// landing square at once
+	MultiCapture bool `json:"multi_capture,omitempty"`
+	// From and To are where Character started and ended up
+	From Square `json:"from"`
+	To   Square `json:"to"`
+	// Path lists every cell a moved piece passed through, From and To
+	// included
+	Path []Square `json:"path,omitempty"`
+	// Pass is set for a turn passed without moving, which has no Character
+	Pass bool `json:"pass,omitempty"`
+	// Comments are the players' annotations on the move, oldest first
+	Comments []Comment `json:"comments,omitempty"`
+}
+
+// Player represents a player in the game
+type Player struct {
+	ID         int          `json:"id"`
+	Name       string       `json:"name"`
+	UserID     string       `json:"user_id,omitempty"`
+	Characters []*Character `json:"characters"`
+}
+
+// Character represents a game piece
+type Character struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Owner int    `json:"owner"`
+}
+
+// Move represents a move command
+type Move struct {
+	CharacterName string `json:"character_name"`
+	Direction     string `json:"direction"`
+	Nonce         string `json:"nonce,omitempty"`
+}
+
+// SetupPiece is where a setup puts one of a player's pieces
+type SetupPiece struct {
+	Type string `json:"type"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+}
+
+// Square is a cell on the board
+type Square struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Directions lists every direction token a move can use
+var Directions = []string{"L", "R", "F", "B", "FL", "FR", "BL", "BR"}
+
+// NoWinner is the Winner of a drawn game
+const NoWinner = -1
+
+// Reasons a game can end with
+const (
+	ReasonElimination    = "elimination"
+	ReasonResignation    = "resignation"
+	ReasonForfeit        = "forfeit"
+	ReasonTimeout        = "timeout"
+	ReasonDrawStalemate  = "draw_stalemate"
+	ReasonDrawRepetition = "draw_repetition"
+	ReasonDrawMaterial   = "draw_insufficient_material"
+	ReasonDrawMoveLimit  = "draw_move_limit"
+	ReasonAborted        = "aborted"
+	ReasonAbandoned      = "abandoned"
+	ReasonKingCaptured   = "king_captured"
+	ReasonCheckmate      = "checkmate"
+	ReasonReachedGoal    = "reached_goal"
+	ReasonFirstCapture   = "first_capture"
+	ReasonImmobilized    = "immobilized"
+	ReasonAgreement      = "agreement"
+
+	// ReasonMoveLimitCaptures is a game at the move limit won on captures
+	ReasonMoveLimitCaptures = "move_limit_captures"
+)
+
+// NewGame sets up a game with the rules' pieces on each player's home row.
+// With random placement enabled, rng shuffles the order of each row.
+func NewGame(rng *rand.Rand, rules Rules) *Game {
+	game := &Game{
+		Board:         make([][]*Character, rules.BoardHeight),
+		Players:       [2]*Player{},
+		CurrentPlayer: 0,
+		GameOver:      false,
+	}
+	for y := range game.Board {
+		game.Board[y] = make([]*Character, rules.BoardWidth)
+	}
+
+	// Initialize players
+	for i := 0; i < 2; i++ {
+		game.Players[i] = &Player{
+			ID:         i,
+			Name:       fmt.Sprintf("Player %d", i+1),
+			Characters: make([]*Character, 0),
+		}
+	}
+
+	// Set up initial board state
+	for playerID := 0; playerID < 2; playerID++ {
+		pieces := append([]string(nil), rules.Pieces...)
+		if rules.RandomPlacement {
+			rng.Shuffle(len(pieces), func(i, j int) {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+			})
+		}
+		y := game.homeRow(playerID)
+		for i, charType := range pieces {
+			x := i
+			if rules.Columns != nil {
+				x = rules.Columns[i]
+			}
+			char := &Character{
+				Type:  charType,
+				Name:  fmt.Sprintf("%s%d", charType[:1], i+1),
+				X:     x,
+				Y:     y,
+				Owner: playerID,
+			}
+			game.Players[playerID].Characters = append(game.Players[playerID].Characters, char)
+			game.Board[y][x] = char
+		}
+	}
+	game.Rules = rules
+	if len(rules.TurnOrder) > 0 {
+		game.FirstPlayer = rules.TurnOrder[0]
+		game.CurrentPlayer = rules.TurnOrder[0]
+	}
+	game.Start = [2][]Character{game.arrangement(0), game.arrangement(1)}
+	game.PositionHistory = []string{game.positionKey()}
+	return game
+}
+
+// ProcessMove plays a player's move, rolling it back and returning why if it
+// breaks the rules. It doesn't check whose turn it is.
+func (g *Game) ProcessMove(move Move, playerID int) error {
+	character := g.FindCharacter(move.CharacterName, playerID)
+	if character == nil {
+		return fmt.Errorf("%w: %s", ErrInvalidCharacter, move.CharacterName)
+	}
+	if err := g.checkPosition(character); err != nil {
+		return fmt.Errorf("move %s %s refused: %w", move.CharacterName, move.Direction, err)
+	}
+	if err := g.checkTouchMove(character.Name); err != nil {
+		return fmt.Errorf("invalid move: %s %s: %w", move.CharacterName, move.Direction, err)
+	}
+
+	if err := g.validateMove(character, move.Direction); err != nil {
+		return fmt.Errorf("invalid move: %s %s: %w", move.CharacterName, move.Direction, err)
+	}
+
+	snap := g.takeSnapshot()
+	layout := g.layoutKey()
+	path := g.moveCharacter(character, move.Direction)
+	if err := g.checkBoardConsistency(); err != nil {
+		g.restoreSnapshot(snap)
+		return fmt.Errorf("move %s %s rolled back: %w", move.CharacterName, move.Direction, err)
+	}
+	if g.Rules.Strict && g.layoutKey() == layout {
+		g.restoreSnapshot(snap)
+		return fmt.Errorf("invalid move: %s %s: %w", move.CharacterName, move.Direction, ErrNoEffect)
+	}
+	if g.Rules.KingSafety && g.kingAttacked(playerID) {
+		g.restoreSnapshot(snap)
+		return fmt.Errorf("invalid move: %s %s: %w", move.CharacterName, move.Direction, ErrKingExposed)
+	}
+	if g.Rules.NoTakeback && g.isTakeback(character, playerID) {
+		g.restoreSnapshot(snap)
+		return fmt.Errorf("invalid move: %s %s: %w", move.CharacterName, move.Direction, ErrTakeback)
+	}
+
+	record := MoveRecord{
+		Player:    playerID,
+		Character: character.Name,
+		Piece:     character.Type,
+		Direction: move.Direction,
+		From:      path[0],
+		To:        Square{X: character.X, Y: character.Y},
+		Path:      path,
+	}
+	opponent := g.Players[(playerID+1)%2]
+	for _, char := range snap.characters[opponent.ID] {
+		if g.FindCharacter(char.Name, opponent.ID) == nil {
+			record.Captured = append(record.Captured, char.Name)
+			record.CapturedTypes = append(record.CapturedTypes, char.Type)
+		}
+	}
+	record.MultiCapture = len(record.Captured) > 1
+	g.Moves = append(g.Moves, record)
+	g.changed()
+	g.finishTurn(playerID)
+	return nil
+}
+
+// ProcessSwap exchanges two adjacent pieces of a player, in place of a move
+func (g *Game) ProcessSwap(nameA, nameB string, playerID int) error {
+	if !g.Rules.AllowSwap || g.Rules.Simultaneous {
+		return fmt.Errorf("swap is %w", ErrNotAllowed)
+	}
+	if g.SwapUsed[playerID] {
+		return fmt.Errorf("player %d has already used their swap", playerID)
+	}
+
+	a := g.FindCharacter(nameA, playerID)
+	if a == nil {
+		return fmt.Errorf("%w: %s", ErrInvalidCharacter, nameA)
+	}
+	b := g.FindCharacter(nameB, playerID)
+	if b == nil || b == a {
+		return fmt.Errorf("%w: %s", ErrInvalidCharacter, nameB)
+	}
+	for _, char := range []*Character{a, b} {
+		if err := g.checkPosition(char); err != nil {
+			return fmt.Errorf("swap %s %s refused: %w", nameA, nameB, err)
+		}
+	}
+	if abs(a.X-b.X)+abs(a.Y-b.Y) != 1 {
+		return fmt.Errorf("invalid swap: %s and %s are not adjacent", nameA, nameB)
+	}
+	if err := g.checkTouchMove(a.Name, b.Name); err != nil {
+		return fmt.Errorf("invalid swap: %s %s: %w", nameA, nameB, err)
+	}
+
+	snap := g.takeSnapshot()
+	layout := g.layoutKey()
+	a.X, a.Y, b.X, b.Y = b.X, b.Y, a.X, a.Y
+	g.Board[a.Y][a.X] = a
+	g.Board[b.Y][b.X] = b
+	g.changed()
+	if err := g.checkBoardConsistency(); err != nil {
+		g.restoreSnapshot(snap)
+		return fmt.Errorf("swap %s %s rolled back: %w", nameA, nameB, err)
+	}
+	if g.Rules.Strict && g.layoutKey() == layout {
+		g.restoreSnapshot(snap)
+		return fmt.Errorf("invalid swap: %s and %s are the same kind of piece: %w", nameA, nameB, ErrNoEffect)
+	}
+	if g.Rules.KingSafety && g.kingAttacked(playerID) {
+		g.restoreSnapshot(snap)
+		return fmt.Errorf("invalid swap: %s %s: %w", nameA, nameB, ErrKingExposed)
+	}
+
+	g.SwapUsed[playerID] = true
+	g.Moves = append(g.Moves, MoveRecord{
+		Player:    playerID,
+		Character: a.Name,
+		Piece:     a.Type,
+		Swap:      b.Name,
+		From:      Square{X: b.X, Y: b.Y},
+		To:        Square{X: a.X, Y: a.Y},
+	})
+	g.changed()
+	g.finishTurn(playerID)
+	return nil
+}
+
+// ProcessPass gives up a player's turn without moving a piece
+func (g *Game) ProcessPass(playerID int) error {
+	if !g.Rules.AllowPass || g.Rules.Simultaneous {
+		return fmt.Errorf("passing is %w", ErrNotAllowed)
+	}
+	if g.Rules.KingSafety && g.kingAttacked(playerID) {
+		return fmt.Errorf("cannot pass: %w", ErrKingExposed)
+	}
+	if err := g.checkTouchMove(); err != nil {
+		return fmt.Errorf("cannot pass: %w", err)
+	}
+	g.Moves = append(g.Moves, MoveRecord{Player: playerID, Pass: true})
+	g.changed()
+	g.finishTurn(playerID)
+	return nil
+}
+
+// ApplyMoves plays a sequence of moves, each for the player whose turn it is,
+// so that they alternate between the players. It stops at the first move that
+// fails, reporting its position in the sequence.
+func (g *Game) ApplyMoves(moves []Move) error {
+	for i, move := range moves {
+		err := ErrGameOver
+		if !g.GameOver {
+			err = g.ProcessMove(move, g.CurrentPlayer)
+		}
+		if err != nil {
+			return fmt.Errorf("move %d (player %d): %w", i+1, g.CurrentPlayer, err)
+		}
+	}
+	return nil
+}
+
+// advanceTurn passes the turn to the next player
+func (g *Game) advanceTurn() {
+	g.CurrentPlayer = g.nextPlayer(g.CurrentPlayer)
+	g.Touched = ""
+}
+
+// nextPlayer is the player whose turn follows playerID's, going round the
+// rules' turn order, or round the players by ID without one
+func (g *Game) nextPlayer(playerID int) int {
+	order := g.Rules.TurnOrder
+	if i := slices.Index(order, playerID); i >= 0 {
+		return order[(i+1)%len(order)]
+	}
+	return (playerID + 1) % len(g.Players)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// snapshot holds what a move can change so that it can be rolled back
+type snapshot struct {
+	board         [][]*Character
+	characters    [2][]*Character
+	positions     map[*Character][2]int
+	currentPlayer int
+	gameOver      bool
+	winner        int
+	reason        string
+	historyLen    int
+	movesLen      int
+	respawns      []Respawn
+	positionID    uint64
+}
+
+func (g *Game) takeSnapshot() snapshot {
+	snap := snapshot{
+		board:         make([][]*Character, len(g.Board)),
+		positions:     make(map[*Character][2]int),
+		currentPlayer: g.CurrentPlayer,
+		gameOver:      g.GameOver,
+		winner:        g.Winner,
+		reason:        g.GameOverReason,
+		historyLen:    len(g.PositionHistory),
+		movesLen:      len(g.Moves),
+		respawns:      append([]Respawn(nil), g.Respawns...),
+		positionID:    g.positionID,
+	}
+	for y, row := range g.Board {
+		snap.board[y] = append([]*Character(nil), row...)
+	}
+	for i, player := range g.Players {
+		snap.characters[i] = append([]*Character(nil), player.Characters...)
+		for _, char := range player.Characters {
+			snap.positions[char] = [2]int{char.X, char.Y}
+		}
+	}
+	return snap
+}
+
+func (g *Game) restoreSnapshot(snap snapshot) {
+	g.Board = snap.board
+	g.CurrentPlayer = snap.currentPlayer
+	g.GameOver = snap.gameOver
+	g.Winner = snap.winner
+	g.GameOverReason = snap.reason
+	g.PositionHistory = g.PositionHistory[:snap.historyLen]
+	g.Moves = g.Moves[:snap.movesLen]
+	g.Respawns = snap.respawns
+	g.positionID = snap.positionID
+	for i, player := range g.Players {
+		player.Characters = snap.characters[i]
+	}
+	for char, pos := range snap.positions {
+		char.X, char.Y = pos[0], pos[1]
+	}
+}
+
+// changed gives the position a new positionID, for anything that moves a
+// piece or records a move
+func (g *Game) changed() {
+	g.lastPositionID++
+	g.positionID = g.lastPositionID
+}
+
+// checkBoardConsistency verifies that every character sits on the board cell
+// matching its coordinates and that no cell holds a character that isn't in
+// play, which together rule out two characters sharing a cell.
+func (g *Game) checkBoardConsistency() error {
+	onBoard := 0
+	for y := range g.Board {
+		for x := range g.Board[y] {
+			if g.Board[y][x] != nil {
+				onBoard++
+			}
+		}
+	}
+
+	inPlay := 0
+	for _, player := range g.Players {
+		for _, char := range player.Characters {
+			inPlay++
+			if !g.inBounds(char.X, char.Y) {
+				return fmt.Errorf("%s is off the board at (%d,%d)", char.Name, char.X, char.Y)
+			}
+			if g.Board[char.Y][char.X] != char {
+				return fmt.Errorf("%s is at (%d,%d) but the board cell does not hold it", char.Name, char.X, char.Y)
+			}
+		}
+	}
+
+	if onBoard != inPlay {
+		return fmt.Errorf("board holds %d characters but %d are in play", onBoard, inPlay)
+	}
+	return nil
+}
+
+// checkPosition verifies that the board cell at a character's coordinates
+// holds it, so that a piece is never moved from a square it isn't on
+func (g *Game) checkPosition(char *Character) error {
+	if !g.inBounds(char.X, char.Y) || g.Board[char.Y][char.X] != char {
+		return fmt.Errorf("%w: %s is at (%d,%d) but the board cell does not hold it", ErrOutOfSync, char.Name, char.X, char.Y)
+	}
+	return nil
+}
+
+// LegalDirections returns the directions a character can currently move in
+func (g *Game) LegalDirections(character *Character) []string {
+	moves := make([]string, 0)
+	for _, direction := range Directions {
+		if g.isValidMove(character, direction) {
+			moves = append(moves, direction)
+		}
+	}
+	return moves
+}
+
+// LegalMoves returns every move a player can currently make. With king safety
+// enforced, that leaves out moves exposing their king, and without takebacks,
+// moves undoing the player's previous move. The moves are cached until the
+// position or the moves played change, since whether a move is a takeback
+// depends on them.
+func (g *Game) LegalMoves(playerID int) []Move {
+	key := g.positionID
+	if g.legalCache[playerID] == nil || g.legalKey[playerID] != key {
+		g.legalCache[playerID] = g.findLegalMoves(playerID)
+		g.legalKey[playerID] = key
+	}
+	return slices.Clone(g.legalCache[playerID])
+}
+
+func (g *Game) findLegalMoves(playerID int) []Move {
+	moves := g.candidateMoves(playerID)
+	if !g.Rules.KingSafety && !g.Rules.NoTakeback {
+		return moves
+	}
+	legal := make([]Move, 0, len(moves))
+	for _, move := range moves {
+		if g.Rules.KingSafety && g.exposesKing(move, playerID) {
+			continue
+		}
+		if g.Rules.NoTakeback && g.undoesMove(move, playerID) {
+			continue
+		}
+		legal = append(legal, move)
+	}
+	return legal
+}
+
+// candidateMoves returns every move each of a player's pieces can make,
+// without regard to king safety
+func (g *Game) candidateMoves(playerID int) []Move {
+	moves := make([]Move, 0)
+	for _, char := range g.Players[playerID].Characters {
+		for _, direction := range g.LegalDirections(char) {
+			moves = append(moves, Move{CharacterName: char.Name, Direction: direction})
+		}
+	}
+	return moves
+}
+
+// FindCharacter returns a player's piece by name, or nil if they have none
+// in play by that name
+func (g *Game) FindCharacter(name string, playerID int) *Character {
+	for _, char := range g.Players[playerID].Characters {
+		if char.Name == name {
+			return char
+		}
+	}
+	return nil
+}
+
+// inBounds reports whether a cell lies on the board
+func (g *Game) inBounds(x, y int) bool {
+	return y >= 0 && y < len(g.Board) && x >= 0 && x < len(g.Board[y])
+}
+
+func (g *Game) isValidMove(character *Character, direction string) bool {
+	return g.validateMove(character, direction) == nil
+}
+
+// validateMove returns why a character cannot move in a direction, or nil if
+// it can
+func (g *Game) validateMove(character *Character, direction string) error {
+	return g.CheckMove(character, direction, func(string, ...any) {})
+}
+
+// CheckMove returns why a character cannot move in a direction, or nil if it
+// can, describing each check it makes to trace
+func (g *Game) CheckMove(character *Character, direction string, trace func(format string, args ...any)) error {
+	newX, newY := CalculateNewPosition(character, direction)
+	trace("%s %s at (%d,%d) moving %s lands on (%d,%d)", character.Type, character.Name, character.X, character.Y, direction, newX, newY)
+
+	// Check the whole path is within bounds, not just the landing square
+	for _, cell := range movePath(character, direction)[1:] {
+		if !g.inBounds(cell.X, cell.Y) {
+			trace("(%d,%d) is off the %dx%d board", cell.X, cell.Y, len(g.Board[0]), len(g.Board))
+			return ErrOutOfBounds
+		}
+	}
+
+	// No piece can land on a friendly piece, unless heroes may push it
+	// aside onto an empty square
+	target := g.Board[newY][newX]
+	if target == nil {
+		trace("(%d,%d) is empty", newX, newY)
+	} else {
+		trace("(%d,%d) holds %s of player %d", newX, newY, target.Name, target.Owner)
+	}
+
+	// Without captures, any piece on the landing square blocks
+	if target != nil && g.Rules.RacePiece != "" {
+		trace("nothing is captured in a race, so %s is in the way", target.Name)
+		if target.Owner == character.Owner {
+			return ErrBlockedByFriendly
+		}
+		return ErrBlockedByEnemy
+	}
+	if target != nil && target.Owner == character.Owner {
+		if !g.canPush(character) {
+			trace("a piece cannot land on a friendly piece")
+			return ErrBlockedByFriendly
+		}
+		pushX, pushY := pushSquare(character, newX, newY)
+		if !g.inBounds(pushX, pushY) || g.Board[pushY][pushX] != nil {
+			trace("%s cannot be pushed to (%d,%d), which is off the board or occupied", target.Name, pushX, pushY)
+			return ErrBlockedByFriendly
+		}
+		trace("%s would be pushed to (%d,%d)", target.Name, pushX, pushY)
+	}
+
+	// A non-capturing piece is blocked by an enemy on its landing square
+	if target != nil && target.Owner != character.Owner && !g.canCapture(character) {
+		trace("%s cannot capture, so it is blocked by %s", character.Type, target.Name)
+		return ErrBlockedByEnemy
+	}
+
+	// A guarded enemy cannot be captured, so it blocks the attacker
+	if target != nil && target.Owner != character.Owner && g.isGuarded(target, character) {
+		guardX, guardY := guardSquare(target, character)
+		trace("%s is guarded by %s behind it at (%d,%d)", target.Name, g.Board[guardY][guardX].Name, guardX, guardY)
+		return ErrGuarded
+	}
+
+	// Check if the move is valid for the character type
+	switch character.Type {
+	case "Pawn":
+		if !isPawnMoveValid(direction) {
+			trace("a Pawn cannot move %s", direction)
+			return ErrIllegalDirection
+		}
+		return nil
+	case "Hero1":
+		return g.checkHero1Move(character, direction, newX, newY, trace)
+	case "Hero2":
+		return g.checkHero2Move(character, direction, newX, newY, trace)
+	}
+
+	trace("unknown piece type %s", character.Type)
+	return ErrInvalidCharacter
+}
+
+func isPawnMoveValid(direction string) bool {
+	return direction == "L" || direction == "R" || direction == "F" || direction == "B"
+}
+
+func (g *Game) checkHero1Move(character *Character, direction string, newX, newY int, trace func(format string, args ...any)) error {
+	if direction != "L" && direction != "R" && direction != "F" && direction != "B" {
+		trace("a Hero1 cannot move %s", direction)
+		return ErrIllegalDirection
+	}
+
+	// Check if there's a friendly character in the path
+	midX, midY := (character.X+newX)/2, (character.Y+newY)/2
+	if g.Board[midY][midX] != nil && g.Board[midY][midX].Owner == character.Owner {
+		trace("the path through (%d,%d) is blocked by friendly %s", midX, midY, g.Board[midY][midX].Name)
+		return ErrBlockedByFriendly
+	}
+	trace("the path through (%d,%d) is clear of friendly pieces", midX, midY)
+
+	return nil
+}
+
+func (g *Game) checkHero2Move(character *Character, direction string, newX, newY int, trace func(format string, args ...any)) error {
+	if direction != "FL" && direction != "FR" && direction != "BL" && direction != "BR" {
+		trace("a Hero2 cannot move %s", direction)
+		return ErrIllegalDirection
+	}
+	if !g.Rules.NoHero2Jump {
+		return nil
+	}
+
+	// Without jumping, a friendly piece on the square Hero2 passes blocks it
+	passX, passY := passedSquare(character, newX, newY)
+	if g.Board[passY][passX] != nil && g.Board[passY][passX].Owner == character.Owner {
+		trace("the path through (%d,%d) is blocked by friendly %s", passX, passY, g.Board[passY][passX].Name)
+		return ErrBlockedByFriendly
+	}
+	trace("the path through (%d,%d) is clear of friendly pieces", passX, passY)
+
+	return nil
+}
+
+// passedSquare is the square a hero passes on its way to newX, newY: the
+// middle of a Hero1's straight move, and the square straight ahead or behind
+// for a Hero2, which then steps diagonally
+func passedSquare(character *Character, newX, newY int) (int, int) {
+	if character.Type == "Hero2" {
+		return character.X, (character.Y + newY) / 2
+	}
+	return (character.X + newX) / 2, (character.Y + newY) / 2
+}
+
+// CalculateNewPosition returns where a character moving in a direction would
+// land, whether or not the move is legal
+func CalculateNewPosition(character *Character, direction string) (int, int) {
+	x, y := character.X, character.Y
+
+	switch character.Type {
+	case "Pawn":
+		switch direction {
+		case "L":
+			x--
+		case "R":
+			x++
+		case "F":
+			y--
+		case "B":
+			y++
+		}
+	case "Hero1":
+		switch direction {
+		case "L":
+			x -= 2
+		case "R":
+			x += 2
+		case "F":
+			y -= 2
+		case "B":
+			y += 2
+		}
+	case "Hero2":
+		switch direction {
+		case "FL":
+			x--
+			y -= 2
+		case "FR":
+			x++
+			y -= 2
+		case "BL":
+			x--
+			y += 2
+		case "BR":
+			x++
+			y += 2
+		}
+	}
+
+	return x, y
+}
+
+// movePath returns the cells a character moving in a direction passes
+// through, from its starting cell to its landing cell
+func movePath(character *Character, direction string) []Square {
+	newX, newY := CalculateNewPosition(character, direction)
+	path := []Square{{X: character.X, Y: character.Y}}
+	if character.Type == "Hero1" || character.Type == "Hero2" {
+		passX, passY := passedSquare(character, newX, newY)
+		path = append(path, Square{X: passX, Y: passY})
+	}
+	return append(path, Square{X: newX, Y: newY})
+}
+
+// moveCharacter plays a move on the board and returns the cells the piece
+// passed through, from its starting cell to its landing cell
+func (g *Game) moveCharacter(character *Character, direction string) []Square {
+	g.changed()
+	newX, newY := CalculateNewPosition(character, direction)
+	path := movePath(character, direction)
+
+	// A Hero1 or Hero2 also captures on the square it passes on the way,
+	// the middle of its path, unless the piece there is guarded from where
+	// the hero set off
+	var passed *Character
+	if character.Type == "Hero1" || character.Type == "Hero2" {
+		target := g.Board[path[1].Y][path[1].X]
+		if target != nil && target.Owner != character.Owner && g.canCapture(character) && g.Rules.RacePiece == "" && !g.isGuarded(target, character) {
+			passed = target
+		}
+	}
+
+	// Push a friendly piece off the landing square
+	if target := g.Board[newY][newX]; target != nil && target.Owner == character.Owner {
+		pushX, pushY := pushSquare(character, newX, newY)
+		g.Board[newY][newX] = nil
+		target.X, target.Y = pushX, pushY
+		g.Board[pushY][pushX] = target
+	}
+
+	// Remove character from old position
+	g.Board[character.Y][character.X] = nil
+
+	// Handle character elimination. CheckMove has already refused moves onto a
+	// guarded piece.
+	if g.Board[newY][newX] != nil && g.Board[newY][newX].Owner != character.Owner && g.canCapture(character) && g.Rules.RacePiece == "" {
+		g.eliminateCharacter(g.Board[newY][newX])
+	}
+
+	// Update character position
+	character.X, character.Y = newX, newY
+	g.Board[newY][newX] = character
+
+	if passed != nil {
+		g.eliminateCharacter(passed)
+		g.Board[passed.Y][passed.X] = nil
+	}
+	return path
+}
+
+// canPush reports whether a character shoves a friendly piece on its landing
+// square one square further instead of being blocked by it
+func (g *Game) canPush(character *Character) bool {
+	return g.Rules.HeroPush && (character.Type == "Hero1" || character.Type == "Hero2")
+}
+
+// pushSquare returns where a piece on a mover's landing square is pushed to:
+// one square further on in the direction of the move
+func pushSquare(character *Character, newX, newY int) (int, int) {
+	return newX + sign(newX-character.X), newY + sign(newY-character.Y)
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// canCapture reports whether a character eliminates the enemies it moves onto
+func (g *Game) canCapture(character *Character) bool {
+	for _, charType := range g.Rules.NonCapturing {
+		if charType == character.Type {
+			return false
+		}
+	}
+	return true
+}
+
+// isGuarded reports whether a piece attacked by attacker is immune to capture
+// because a friendly piece stands directly behind it, as seen from the
+// attacker
+func (g *Game) isGuarded(target, attacker *Character) bool {
+	if !g.Rules.Guarding {
+		return false
+	}
+	guardX, guardY := guardSquare(target, attacker)
+	if !g.inBounds(guardX, guardY) {
+		return false
+	}
+	guard := g.Board[guardY][guardX]
+	return guard != nil && guard.Owner == target.Owner
+}
+
+// guardSquare is the square behind a piece, as seen from its attacker
+func guardSquare(target, attacker *Character) (int, int) {
+	return target.X + sign(target.X-attacker.X), target.Y + sign(target.Y-attacker.Y)
+}
+
+func (g *Game) eliminateCharacter(character *Character) {
+	player := g.Players[character.Owner]
+	for i, char := range player.Characters {
+		if char == character {
+			player.Characters = append(player.Characters[:i], player.Characters[i+1:]...)
+			break
+		}
+	}
+	if g.Rules.RespawnTurns > 0 {
+		// The move doing the capturing hasn't been recorded yet
+		turn := g.MoveCount() + 1 + g.Rules.RespawnTurns
+		g.Respawns = append(g.Respawns, Respawn{Character: character, Turn: turn})
+	}
+}
+
+// respawn returns captured pieces whose time has come to the first free
+// squares of their owner's home row. A piece with no free square to return to
+// waits until one frees up.
+func (g *Game) respawn() {
+	waiting := g.Respawns[:0:0]
+	for _, respawn := range g.Respawns {
+		char := respawn.Character
+		row := g.homeRow(char.Owner)
+		x := slices.Index(g.Board[row], nil)
+		if respawn.Turn > g.MoveCount() || x < 0 {
+			waiting = append(waiting, respawn)
+			continue
+		}
+		char.X, char.Y = x, row
+		g.Board[row][x] = char
+		g.changed()
+		g.Players[char.Owner].Characters = append(g.Players[char.Owner].Characters, char)
+	}
+	g.Respawns = waiting
+}
+
+// finishTurn passes the turn on after a player's action and ends the game if
+// that action won or drew it
+func (g *Game) finishTurn(playerID int) {
+	g.DrawOffered[(playerID+1)%2] = false
+	g.advanceTurn()
+	if g.kingCaptured(g.CurrentPlayer) {
+		g.EndGame(playerID, ReasonKingCaptured)
+		return
+	}
+	if g.Rules.FirstCapture && len(g.Moves[len(g.Moves)-1].Captured) > 0 {
+		g.EndGame(playerID, ReasonFirstCapture)
+		return
+	}
+	g.respawn()
+
+	if g.checkGameOver() {
+		g.EndGame(playerID, ReasonElimination)
+		return
+	}
+	if g.reachedGoal(playerID) {
+		g.EndGame(playerID, ReasonReachedGoal)
+		return
+	}
+	if g.Rules.RacePiece == "" && g.isDeadPosition() {
+		g.EndGame(NoWinner, ReasonDrawMaterial)
+		return
+	}
+
+	key := g.positionKey()
+	g.PositionHistory = append(g.PositionHistory, key)
+	repetitions := g.trimmedPositions[key]
+	for _, seen := range g.PositionHistory {
+		if seen == key {
+			repetitions++
+		}
+	}
+	if repetitions >= 3 {
+		g.EndGame(NoWinner, ReasonDrawRepetition)
+		return
+	}
+
+	if g.Rules.MaxMoves > 0 && g.MoveCount() >= g.Rules.MaxMoves {
+		g.endAtMoveLimit()
+		return
+	}
+
+	if len(g.LegalMoves(g.CurrentPlayer)) == 0 {
+		if g.Rules.KingSafety && g.kingAttacked(g.CurrentPlayer) {
+			g.EndGame(playerID, ReasonCheckmate)
+			return
+		}
+		if g.Rules.ImmobilizedLoses && g.permanentlyImmobilized(g.CurrentPlayer) {
+			g.EndGame(playerID, ReasonImmobilized)
+			return
+		}
+		g.EndGame(NoWinner, ReasonDrawStalemate)
+	}
+}
+
+// endAtMoveLimit ends a game that has run out of moves. It is drawn unless
+// tie-breaking by captures is enabled and one player has captured more.
+func (g *Game) endAtMoveLimit() {
+	if !g.Rules.CaptureTiebreak {
+		g.EndGame(NoWinner, ReasonDrawMoveLimit)
+		return
+	}
+	captures := g.captures()
+	switch {
+	case captures[0] > captures[1]:
+		g.EndGame(0, ReasonMoveLimitCaptures)
+	case captures[1] > captures[0]:
+		g.EndGame(1, ReasonMoveLimitCaptures)
+	default:
+		g.EndGame(NoWinner, ReasonDrawMoveLimit)
+	}
+}
+
+// captures counts the pieces each player has taken
+func (g *Game) captures() [2]int {
+	var captures [2]int
+	for playerID, pieces := range g.Captures() {
+		captures[playerID] = len(pieces)
+	}
+	return captures
+}
+
+// CapturedPiece is an opponent's piece a player has captured
+type CapturedPiece struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Captures lists the pieces each player has captured, in the order they were
+// taken. A piece that respawned and was taken again is listed each time.
+func (g *Game) Captures() [2][]CapturedPiece {
+	captures := [2][]CapturedPiece{
+		append([]CapturedPiece{}, g.trimmedCaptures[0]...),
+		append([]CapturedPiece{}, g.trimmedCaptures[1]...),
+	}
+	for _, move := range g.Moves {
+		for i, name := range move.Captured {
+			captures[move.Player] = append(captures[move.Player], CapturedPiece{Name: name, Type: move.CapturedTypes[i]})
+		}
+	}
+	return captures
+}
+
+// deadPositionRules each recognise a kind of position in which no piece can
+// ever be captured again, so the game can only be drawn
+var deadPositionRules = []func(g *Game) bool{
+	(*Game).onlyNonCapturingPieces,
+}
+
+func (g *Game) isDeadPosition() bool {
+	for _, rule := range deadPositionRules {
+		if rule(g) {
+			return true
+		}
+	}
+	return false
+}
+
+// onlyNonCapturingPieces matches positions where no remaining piece captures
+func (g *Game) onlyNonCapturingPieces() bool {
+	for _, player := range g.Players {
+		for _, char := range player.Characters {
+			if g.canCapture(char) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// reachedGoal reports whether, in a race, one of a player's race pieces
+// stands on the opponent's home row
+func (g *Game) reachedGoal(playerID int) bool {
+	if g.Rules.RacePiece == "" {
+		return false
+	}
+	goal := g.homeRow((playerID + 1) % 2)
+	for _, char := range g.Players[playerID].Characters {
+		if char.Type == g.Rules.RacePiece && char.Y == goal {
+			return true
+		}
+	}
+	return false
+}
+
+// EndGame finishes the game with a winner, or NoWinner for a draw
+func (g *Game) EndGame(winner int, reason string) {
+	g.GameOver = true
+	g.Winner = winner
+	g.GameOverReason = reason
+}
+
+// positionKey identifies the board layout and the player to move
+func (g *Game) positionKey() string {
+	var b strings.Builder
+	for _, row := range g.Board {
+		for _, char := range row {
+			if char == nil {
+				b.WriteString(".")
+			} else {
+				fmt.Fprintf(&b, "%d%s", char.Owner, char.Name)
+			}
+			b.WriteString(",")
+		}
+	}
+	fmt.Fprintf(&b, "%d", g.CurrentPlayer)
+	return b.String()
+}
+
+// layoutKey identifies which kind of piece stands on each square, ignoring
+// piece names, so that actions which only shuffle identical pieces compare
+// equal
+func (g *Game) layoutKey() string {
+	var b strings.Builder
+	for _, row := range g.Board {
+		for _, char := range row {
+			if char == nil {
+				b.WriteString(".")
+			} else {
+				fmt.Fprintf(&b, "%d%s", char.Owner, char.Type)
+			}
+			b.WriteString(",")
+		}
+	}
+	return b.String()
+}
+
+// checkGameOver reports whether a player has been wiped out, with no pieces
+// left on the board and none waiting to respawn
+func (g *Game) checkGameOver() bool {
+	for _, player := range g.Players {
+		if len(player.Characters) == 0 && !g.awaitingRespawn(player.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// awaitingRespawn reports whether any of a player's pieces are queued to
+// respawn
+func (g *Game) awaitingRespawn(playerID int) bool {
+	for _, respawn := range g.Respawns {
+		if respawn.Character.Owner == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+// Clone returns a copy of the game that shares nothing with it, so that one
+// can be changed without affecting the other
+func (g *Game) Clone() *Game {
+	copied := *g
+	chars := make(map[*Character]*Character)
+	for i, player := range g.Players {
+		p := *player
+		p.Characters = make([]*Character, len(player.Characters))
+		for j, char := range player.Characters {
+			c := *char
+			chars[char] = &c
+			p.Characters[j] = &c
+		}
+		copied.Players[i] = &p
+	}
+	copied.Board = make([][]*Character, len(g.Board))
+	for y, row := range g.Board {
+		copied.Board[y] = make([]*Character, len(row))
+		for x, char := range row {
+			if char != nil {
+				copied.Board[y][x] = chars[char]
+			}
+		}
+	}
+	copied.Respawns = make([]Respawn, len(g.Respawns))
+	for i, respawn := range g.Respawns {
+		c := *respawn.Character
+		copied.Respawns[i] = Respawn{Character: &c, Turn: respawn.Turn}
+	}
+	copied.PositionHistory = append([]string(nil), g.PositionHistory...)
+	copied.Moves = make([]MoveRecord, len(g.Moves))
+	for i, move := range g.Moves {
+		move.Captured = append([]string(nil), move.Captured...)
+		move.CapturedTypes = append([]string(nil), move.CapturedTypes...)
+		move.Path = append([]Square(nil), move.Path...)
+		move.Comments = append([]Comment(nil), move.Comments...)
+		copied.Moves[i] = move
+	}
+	for i, move := range g.Pending {
+		if move != nil {
+			m := *move
+			copied.Pending[i] = &m
+		}
+	}
+	copied.trimmedPositions = maps.Clone(g.trimmedPositions)
+	for i, pieces := range g.trimmedCaptures {
+		copied.trimmedCaptures[i] = slices.Clone(pieces)
+	}
+	copied.Rules.Pieces = slices.Clone(g.Rules.Pieces)
+	copied.Rules.Columns = slices.Clone(g.Rules.Columns)
+	copied.Rules.NonCapturing = slices.Clone(g.Rules.NonCapturing)
+	copied.Rules.TurnOrder = slices.Clone(g.Rules.TurnOrder)
+	copied.Rules.PieceValues = maps.Clone(g.Rules.PieceValues)
+	return &copied
+}
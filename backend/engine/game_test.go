@@ -0,0 +1,735 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testRules are the server's default rules: a 5x5 board with a row of pawns
+// and heroes for each player
+func testRules() Rules {
+	return Rules{
+		BoardWidth:  5,
+		BoardHeight: 5,
+		Pieces:      []string{"Pawn", "Hero1", "Pawn", "Hero2", "Pawn"},
+	}
+}
+
+// newTestGame sets up a started game by rules with the pieces on their home
+// rows, player 0 on row 0 and player 1 on the last row
+func newTestGame(rules Rules) *Game {
+	game := NewGame(rand.New(rand.NewSource(1)), rules)
+	game.Started = true
+	return game
+}
+
+// newPosition sets up a started game with only the given pieces on the
+// board, player 0 to move
+func newPosition(t *testing.T, rules Rules, pieces ...Character) *Game {
+	t.Helper()
+	g := newTestGame(rules)
+	for y := range g.Board {
+		clear(g.Board[y])
+	}
+	for _, player := range g.Players {
+		player.Characters = nil
+	}
+	for _, piece := range pieces {
+		char := piece
+		g.Players[char.Owner].Characters = append(g.Players[char.Owner].Characters, &char)
+		g.Board[char.Y][char.X] = &char
+	}
+	return g
+}
+
+// mustMove plays a move, failing the test if it is rejected
+func mustMove(t *testing.T, g *Game, name, direction string, playerID int) {
+	t.Helper()
+	if err := g.ProcessMove(Move{CharacterName: name, Direction: direction}, playerID); err != nil {
+		t.Fatalf("%s %s: %v", name, direction, err)
+	}
+}
+
+func TestInconsistentMoveRolledBack(t *testing.T) {
+	g := newTestGame(testRules())
+	// P1 claims a square its board cell doesn't match, so any move leaves the
+	// board inconsistent
+	g.FindCharacter("P1", 0).X = 1
+	before := g.positionKey()
+
+	err := g.ProcessMove(Move{CharacterName: "P3", Direction: "B"}, 0)
+	if err == nil {
+		t.Fatal("move on an inconsistent board was accepted")
+	}
+	if g.positionKey() != before {
+		t.Error("rejected move was not rolled back")
+	}
+	if len(g.Moves) != 0 || g.CurrentPlayer != 0 {
+		t.Errorf("rejected move left %d moves and player %d to move", len(g.Moves), g.CurrentPlayer)
+	}
+	if p3 := g.FindCharacter("P3", 0); p3.X != 2 || p3.Y != 0 {
+		t.Errorf("P3 left at (%d,%d), want (2,0)", p3.X, p3.Y)
+	}
+}
+
+func TestMoveFromPhantomSquare(t *testing.T) {
+	rules := testRules()
+	rules.AllowSwap = true
+	g := newTestGame(rules)
+	// P1 claims (0,1) but the board still holds it on (0,0)
+	g.FindCharacter("P1", 0).Y = 1
+	before := g.positionKey()
+
+	if err := g.ProcessMove(Move{CharacterName: "P1", Direction: "B"}, 0); !errors.Is(err, ErrOutOfSync) {
+		t.Fatalf("move of a desynced piece: got %v, want ErrOutOfSync", err)
+	}
+	if err := g.ProcessSwap("H2", "P1", 0); !errors.Is(err, ErrOutOfSync) {
+		t.Fatalf("swap with a desynced piece: got %v, want ErrOutOfSync", err)
+	}
+	if g.positionKey() != before || len(g.Moves) != 0 || g.CurrentPlayer != 0 {
+		t.Errorf("rejected moves changed the game: %d moves, player %d to move", len(g.Moves), g.CurrentPlayer)
+	}
+	if g.Board[2][0] != nil {
+		t.Error("piece moved from its phantom square")
+	}
+}
+
+func TestNonCapturingPieceBlockedByEnemy(t *testing.T) {
+	rules := testRules()
+	rules.NonCapturing = []string{"Pawn"}
+	g := newPosition(t, rules,
+		Character{Type: "Pawn", Name: "P1", X: 2, Y: 2, Owner: 0},
+		Character{Type: "Hero1", Name: "H2", X: 0, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 2, Y: 3, Owner: 1},
+		Character{Type: "Pawn", Name: "P3", X: 2, Y: 4, Owner: 1},
+	)
+	err := g.ProcessMove(Move{CharacterName: "P1", Direction: "B"}, 0)
+	if !errors.Is(err, ErrBlockedByEnemy) {
+		t.Fatalf("non-capturing pawn onto an enemy: got %v, want %v", err, ErrBlockedByEnemy)
+	}
+
+	// A hero still captures
+	g = newPosition(t, rules,
+		Character{Type: "Hero1", Name: "H2", X: 2, Y: 1, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 2, Y: 3, Owner: 1},
+		Character{Type: "Pawn", Name: "P3", X: 0, Y: 4, Owner: 1},
+	)
+	mustMove(t, g, "H2", "B", 0)
+	if g.FindCharacter("P1", 1) != nil {
+		t.Fatal("hero did not capture the pawn it landed on")
+	}
+}
+
+func TestPlayerSerialization(t *testing.T) {
+	g := newTestGame(testRules())
+	data, err := json.Marshal(g.Players[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		ID         int              `json:"id"`
+		Name       string           `json:"name"`
+		Characters []map[string]any `json:"characters"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID != 1 || decoded.Name != "Player 2" || len(decoded.Characters) != 5 {
+		t.Fatalf("player serialized as %s", data)
+	}
+	want := map[string]any{"type": "Hero1", "name": "H2", "x": 1.0, "y": 4.0, "owner": 1.0}
+	if got := decoded.Characters[1]; !maps.Equal(got, want) {
+		t.Errorf("character serialized as %v, want %v", got, want)
+	}
+}
+
+func TestSwap(t *testing.T) {
+	rules := testRules()
+	rules.AllowSwap = true
+	g := newTestGame(rules)
+	if err := g.ProcessSwap("P1", "P3", 0); err == nil {
+		t.Fatal("swap of pieces that aren't adjacent was accepted")
+	}
+	if err := g.ProcessSwap("P1", "H2", 0); err != nil {
+		t.Fatal(err)
+	}
+	if p1, h2 := g.FindCharacter("P1", 0), g.FindCharacter("H2", 0); p1.X != 1 || h2.X != 0 || g.Board[0][0] != h2 {
+		t.Fatalf("after the swap P1 is on column %d and H2 on %d", p1.X, h2.X)
+	}
+	if g.CurrentPlayer != 1 || g.Moves[0].Swap != "H2" {
+		t.Fatalf("swap didn't use up the turn: player %d to move, moves %+v", g.CurrentPlayer, g.Moves)
+	}
+	mustMove(t, g, "P1", "F", 1)
+	if err := g.ProcessSwap("P1", "H2", 0); err == nil {
+		t.Fatal("second swap was accepted")
+	}
+}
+
+func TestSwapNotAllowed(t *testing.T) {
+	g := newTestGame(testRules())
+	if err := g.ProcessSwap("P1", "H2", 0); !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("got %v, want %v", err, ErrNotAllowed)
+	}
+}
+
+func TestStrictRejectsNoOpSwap(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		rules := testRules()
+		rules.AllowSwap = true
+		rules.Strict = strict
+		g := newPosition(t, rules,
+			Character{Type: "Pawn", Name: "P1", X: 0, Y: 0, Owner: 0},
+			Character{Type: "Pawn", Name: "P2", X: 1, Y: 0, Owner: 0},
+			Character{Type: "Pawn", Name: "P1", X: 0, Y: 4, Owner: 1},
+		)
+		err := g.ProcessSwap("P1", "P2", 0)
+		if strict && !errors.Is(err, ErrNoEffect) {
+			t.Errorf("strict swap of two pawns: got %v, want %v", err, ErrNoEffect)
+		}
+		if !strict && err != nil {
+			t.Errorf("swap of two pawns: %v", err)
+		}
+		if strict && (g.FindCharacter("P1", 0).X != 0 || g.CurrentPlayer != 0) {
+			t.Error("rejected swap was not rolled back")
+		}
+	}
+}
+
+func TestPass(t *testing.T) {
+	g := newTestGame(testRules())
+	if err := g.ProcessPass(0); !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("pass without passing allowed: got %v, want %v", err, ErrNotAllowed)
+	}
+
+	rules := testRules()
+	rules.AllowPass = true
+	g = newTestGame(rules)
+	if err := g.ProcessPass(0); err != nil {
+		t.Fatal(err)
+	}
+	if g.CurrentPlayer != 1 || len(g.Moves) != 1 || !g.Moves[0].Pass {
+		t.Fatalf("after the pass player %d is to move, moves %+v", g.CurrentPlayer, g.Moves)
+	}
+	mustMove(t, g, "P1", "F", 1)
+}
+
+func TestMovePath(t *testing.T) {
+	g := newTestGame(testRules())
+	mustMove(t, g, "H2", "B", 0)
+	mustMove(t, g, "P1", "F", 1)
+	want := [][]Square{
+		{{X: 1, Y: 0}, {X: 1, Y: 1}, {X: 1, Y: 2}},
+		{{X: 0, Y: 4}, {X: 0, Y: 3}},
+	}
+	for i, move := range g.Moves {
+		if !slices.Equal(move.Path, want[i]) || move.From != want[i][0] || move.To != want[i][len(want[i])-1] {
+			t.Errorf("move %d went from %v to %v along %v, want %v", i, move.From, move.To, move.Path, want[i])
+		}
+	}
+}
+
+func TestRepetitionDraw(t *testing.T) {
+	g := newTestGame(testRules())
+	moves := []Move{
+		{CharacterName: "P1", Direction: "B"},
+		{CharacterName: "P1", Direction: "F"},
+		{CharacterName: "P1", Direction: "F"},
+		{CharacterName: "P1", Direction: "B"},
+	}
+	// The start position comes round a second time after four moves and a
+	// third after eight
+	for i := 0; i < 8; i++ {
+		if g.GameOver {
+			t.Fatalf("game ended after %d moves", i)
+		}
+		mustMove(t, g, moves[i%4].CharacterName, moves[i%4].Direction, i%2)
+	}
+	if !g.GameOver || g.Winner != NoWinner || g.GameOverReason != ReasonDrawRepetition {
+		t.Fatalf("threefold repetition: over %v, winner %d, reason %q", g.GameOver, g.Winner, g.GameOverReason)
+	}
+}
+
+func TestInsufficientMaterialDraw(t *testing.T) {
+	rules := testRules()
+	rules.NonCapturing = []string{"Pawn"}
+	g := newTestGame(rules)
+	mustMove(t, g, "P1", "B", 0)
+	if g.GameOver {
+		t.Fatal("game with heroes left was drawn")
+	}
+
+	rules.Pieces = []string{"Pawn", "Pawn", "Pawn"}
+	g = newTestGame(rules)
+	mustMove(t, g, "P1", "B", 0)
+	if !g.GameOver || g.Winner != NoWinner || g.GameOverReason != ReasonDrawMaterial {
+		t.Fatalf("game of non-capturing pawns: over %v, winner %d, reason %q", g.GameOver, g.Winner, g.GameOverReason)
+	}
+}
+
+func TestRandomPlacement(t *testing.T) {
+	rules := testRules()
+	rules.RandomPlacement = true
+	shuffled := false
+	for seed := int64(1); seed <= 10; seed++ {
+		g := NewGame(rand.New(rand.NewSource(seed)), rules)
+		for playerID, player := range g.Players {
+			var types []string
+			for x, char := range g.Board[g.homeRow(playerID)] {
+				if char == nil || char.Owner != playerID || char.X != x {
+					t.Fatalf("seed %d: home row of player %d holds %+v at column %d", seed, playerID, char, x)
+				}
+				types = append(types, char.Type)
+				if char.Type != rules.Pieces[x] {
+					shuffled = true
+				}
+			}
+			if len(player.Characters) != len(rules.Pieces) || !sameElements(types, rules.Pieces) {
+				t.Fatalf("seed %d: player %d starts with %v, want the pieces %v", seed, playerID, types, rules.Pieces)
+			}
+		}
+	}
+	if !shuffled {
+		t.Error("no seed changed the order of the pieces")
+	}
+}
+
+// sameElements reports whether two lists hold the same strings in any order
+func sameElements(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+func TestMoveLimit(t *testing.T) {
+	for _, tiebreak := range []bool{false, true} {
+		rules := testRules()
+		rules.MaxMoves = 2
+		rules.CaptureTiebreak = tiebreak
+		g := newPosition(t, rules,
+			Character{Type: "Hero1", Name: "H2", X: 0, Y: 0, Owner: 0},
+			Character{Type: "Pawn", Name: "P5", X: 4, Y: 0, Owner: 0},
+			Character{Type: "Pawn", Name: "P1", X: 0, Y: 2, Owner: 1},
+			Character{Type: "Pawn", Name: "P3", X: 2, Y: 4, Owner: 1},
+			Character{Type: "Pawn", Name: "P5", X: 4, Y: 4, Owner: 1},
+		)
+		mustMove(t, g, "H2", "B", 0)
+		if g.GameOver {
+			t.Fatal("game ended before the move limit")
+		}
+		mustMove(t, g, "P5", "F", 1)
+
+		winner, reason := NoWinner, ReasonDrawMoveLimit
+		if tiebreak {
+			winner, reason = 0, ReasonMoveLimitCaptures
+		}
+		if !g.GameOver || g.Winner != winner || g.GameOverReason != reason {
+			t.Errorf("tiebreak %v: at the limit over %v, winner %d by %q, want %d by %q", tiebreak, g.GameOver, g.Winner, g.GameOverReason, winner, reason)
+		}
+	}
+}
+
+func TestHeroPush(t *testing.T) {
+	start := []Character{
+		{Type: "Hero1", Name: "H2", X: 1, Y: 0, Owner: 0},
+		{Type: "Pawn", Name: "P1", X: 1, Y: 2, Owner: 0},
+		{Type: "Pawn", Name: "P1", X: 4, Y: 4, Owner: 1},
+	}
+	rules := testRules()
+	g := newPosition(t, rules, start...)
+	if err := g.ProcessMove(Move{CharacterName: "H2", Direction: "B"}, 0); err == nil {
+		t.Fatal("hero landed on a friendly piece without pushing allowed")
+	}
+
+	rules.HeroPush = true
+	g = newPosition(t, rules, start...)
+	mustMove(t, g, "H2", "B", 0)
+	if h2, p1 := g.FindCharacter("H2", 0), g.FindCharacter("P1", 0); h2.Y != 2 || p1.Y != 3 || g.Board[3][1] != p1 {
+		t.Fatalf("after the push H2 is on row %d and P1 on row %d, want 2 and 3", h2.Y, p1.Y)
+	}
+
+	// Nothing is pushed onto an occupied square
+	g = newPosition(t, rules, append(start, Character{Type: "Pawn", Name: "P5", X: 1, Y: 3, Owner: 0})...)
+	if err := g.ProcessMove(Move{CharacterName: "H2", Direction: "B"}, 0); err == nil {
+		t.Fatal("hero pushed a piece onto an occupied square")
+	}
+}
+
+func TestRespawn(t *testing.T) {
+	rules := testRules()
+	rules.RespawnTurns = 1
+	g := newPosition(t, rules,
+		Character{Type: "Hero1", Name: "H2", X: 0, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P5", X: 4, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 0, Y: 2, Owner: 1},
+		Character{Type: "Pawn", Name: "P3", X: 2, Y: 4, Owner: 1},
+	)
+	mustMove(t, g, "H2", "B", 0)
+	if g.FindCharacter("P1", 1) != nil || len(g.Respawns) != 1 {
+		t.Fatalf("captured P1 is on the board or not waiting to respawn: %+v", g.Respawns)
+	}
+
+	// One move later it is back on the first free square of its home row
+	mustMove(t, g, "P3", "F", 1)
+	p1 := g.FindCharacter("P1", 1)
+	if p1 == nil || p1.X != 0 || p1.Y != 4 || g.Board[4][0] != p1 || len(g.Respawns) != 0 {
+		t.Fatalf("P1 respawned as %+v, waiting %+v", p1, g.Respawns)
+	}
+}
+
+func TestGuarding(t *testing.T) {
+	rules := testRules()
+	rules.Guarding = true
+	g := newPosition(t, rules,
+		Character{Type: "Pawn", Name: "P1", X: 2, Y: 1, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 2, Y: 2, Owner: 1},
+		Character{Type: "Pawn", Name: "P3", X: 2, Y: 3, Owner: 1},
+	)
+	if err := g.ProcessMove(Move{CharacterName: "P1", Direction: "B"}, 0); !errors.Is(err, ErrGuarded) {
+		t.Fatalf("capture of a guarded pawn: got %v, want %v", err, ErrGuarded)
+	}
+
+	// A hero passing a guarded piece leaves it be, while taking the
+	// unguarded piece it lands on
+	passing := []Character{
+		{Type: "Hero1", Name: "H2", X: 2, Y: 0, Owner: 0},
+		{Type: "Pawn", Name: "P1", X: 2, Y: 1, Owner: 1},
+		{Type: "Pawn", Name: "P3", X: 2, Y: 2, Owner: 1},
+		{Type: "Pawn", Name: "P5", X: 4, Y: 4, Owner: 1},
+	}
+	g = newPosition(t, rules, passing...)
+	mustMove(t, g, "H2", "B", 0)
+	if g.FindCharacter("P1", 1) == nil || g.FindCharacter("P3", 1) != nil {
+		t.Fatalf("after the hero's move player 1 has %+v, want P1 spared and P3 taken", g.Players[1].Characters)
+	}
+	if captured := g.Moves[0].Captured; len(captured) != 1 || captured[0] != "P3" {
+		t.Errorf("move recorded capturing %v, want [P3]", captured)
+	}
+
+	// Without guarding it takes both
+	rules.Guarding = false
+	g = newPosition(t, rules, passing...)
+	mustMove(t, g, "H2", "B", 0)
+	if captured := g.Moves[0].Captured; len(captured) != 2 {
+		t.Errorf("move without guarding recorded capturing %v, want both pawns", captured)
+	}
+}
+
+func TestLegalMovesCache(t *testing.T) {
+	g := newTestGame(testRules())
+	g.LegalMoves(0)
+
+	// A hit hands back whatever is cached, so a planted entry shows whether
+	// the moves were looked up again
+	planted := []Move{{CharacterName: "planted"}}
+	g.legalCache[0] = planted
+	if got := g.LegalMoves(0); !slices.Equal(got, planted) {
+		t.Fatalf("unchanged position got %v, want the cached moves", got)
+	}
+
+	// Rolling a move back returns to the position the cache was filled in
+	snap := g.takeSnapshot()
+	g.moveCharacter(g.FindCharacter("P1", 0), "B")
+	g.restoreSnapshot(snap)
+	if got := g.LegalMoves(0); !slices.Equal(got, planted) {
+		t.Fatalf("rolled back position got %v, want the cached moves", got)
+	}
+
+	// Another position reached from it is new, even though it was reached
+	// from the same one
+	snap = g.takeSnapshot()
+	g.moveCharacter(g.FindCharacter("P3", 0), "B")
+	if got := g.LegalMoves(0); slices.Equal(got, planted) {
+		t.Fatal("position after a different move got the cached moves")
+	}
+	g.restoreSnapshot(snap)
+
+	g.legalCache[0] = planted
+	mustMove(t, g, "P1", "B", 0)
+	if got := g.LegalMoves(0); slices.Equal(got, planted) {
+		t.Fatalf("position after a move got %v, want its own moves", got)
+	}
+}
+
+func TestNoHero2Jump(t *testing.T) {
+	start := []Character{
+		{Type: "Hero2", Name: "H4", X: 3, Y: 0, Owner: 0},
+		{Type: "Pawn", Name: "P5", X: 3, Y: 1, Owner: 0},
+		{Type: "Pawn", Name: "P1", X: 0, Y: 4, Owner: 1},
+	}
+	rules := testRules()
+	mustMove(t, newPosition(t, rules, start...), "H4", "BL", 0)
+
+	rules.NoHero2Jump = true
+	g := newPosition(t, rules, start...)
+	if err := g.ProcessMove(Move{CharacterName: "H4", Direction: "BL"}, 0); !errors.Is(err, ErrBlockedByFriendly) {
+		t.Fatalf("Hero2 jumping a friendly piece: got %v, want %v", err, ErrBlockedByFriendly)
+	}
+
+	// Only a friendly piece is in the way
+	start[1].Owner = 1
+	mustMove(t, newPosition(t, rules, start...), "H4", "BL", 0)
+}
+
+func TestRace(t *testing.T) {
+	rules := testRules()
+	rules.RacePiece = "Pawn"
+	g := newPosition(t, rules,
+		Character{Type: "Pawn", Name: "P1", X: 0, Y: 3, Owner: 0},
+		Character{Type: "Hero1", Name: "H2", X: 1, Y: 2, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 1, Y: 4, Owner: 1},
+		Character{Type: "Pawn", Name: "P3", X: 4, Y: 4, Owner: 1},
+	)
+
+	// Nothing is captured, so an enemy piece blocks like a friendly one
+	if err := g.ProcessMove(Move{CharacterName: "H2", Direction: "B"}, 0); !errors.Is(err, ErrBlockedByEnemy) {
+		t.Fatalf("hero onto an enemy in a race: got %v, want %v", err, ErrBlockedByEnemy)
+	}
+	mustMove(t, g, "P1", "B", 0)
+	if !g.GameOver || g.Winner != 0 || g.GameOverReason != ReasonReachedGoal {
+		t.Fatalf("pawn on the far row: over %v, winner %d, reason %q", g.GameOver, g.Winner, g.GameOverReason)
+	}
+}
+
+func TestApplyMoves(t *testing.T) {
+	g := newTestGame(testRules())
+	err := g.ApplyMoves([]Move{
+		{CharacterName: "P1", Direction: "B"},
+		{CharacterName: "P1", Direction: "F"},
+		{CharacterName: "P3", Direction: "B"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Moves) != 3 || g.Moves[1].Player != 1 || g.CurrentPlayer != 1 {
+		t.Fatalf("got %d moves with player %d to move, want 3 alternating with player 1 to move", len(g.Moves), g.CurrentPlayer)
+	}
+	if p1 := g.FindCharacter("P1", 1); p1.Y != 3 {
+		t.Errorf("player 1's P1 at row %d, want 3", p1.Y)
+	}
+
+	// Player 0's P1 is on the left edge, so the second move fails
+	err = g.ApplyMoves([]Move{
+		{CharacterName: "P3", Direction: "F"},
+		{CharacterName: "P1", Direction: "L"},
+		{CharacterName: "P3", Direction: "F"},
+	})
+	if !errors.Is(err, ErrOutOfBounds) {
+		t.Fatalf("sequence with an illegal move: got %v", err)
+	}
+	if !strings.Contains(err.Error(), "move 2 (player 0)") {
+		t.Errorf("error %q doesn't name the second move", err)
+	}
+	if len(g.Moves) != 4 {
+		t.Errorf("got %d moves, want the 4 before the failing one", len(g.Moves))
+	}
+}
+
+func TestFullGame(t *testing.T) {
+	rules := testRules()
+	rules.MaxMoves = 200
+	g := NewGame(rand.New(rand.NewSource(1)), rules)
+	g.Started = true
+
+	// Both players pick one of their legal moves at random until the game
+	// ends, if only at the move limit
+	rng := rand.New(rand.NewSource(2))
+	for !g.GameOver {
+		moves := g.LegalMoves(g.CurrentPlayer)
+		if len(moves) == 0 {
+			t.Fatalf("player %d has no legal moves in a game still being played", g.CurrentPlayer)
+		}
+		move := moves[rng.Intn(len(moves))]
+		mustMove(t, g, move.CharacterName, move.Direction, g.CurrentPlayer)
+	}
+	if len(g.Moves) > rules.MaxMoves {
+		t.Fatalf("game went on for %d moves, past the limit of %d", len(g.Moves), rules.MaxMoves)
+	}
+	if result := g.Result(); result == "*" || !strings.HasSuffix(strings.TrimSpace(g.Transcript("a")), result) {
+		t.Fatalf("game over with result %q and transcript:\n%s", result, g.Transcript("a"))
+	}
+}
+
+func TestFirstCapture(t *testing.T) {
+	rules := testRules()
+	rules.FirstCapture = true
+	g := newTestGame(rules)
+	mustMove(t, g, "P1", "B", 0)
+	mustMove(t, g, "P1", "F", 1)
+	mustMove(t, g, "P1", "B", 0)
+	if g.GameOver {
+		t.Fatal("game ended before any capture")
+	}
+	mustMove(t, g, "P1", "F", 1)
+	if !g.GameOver || g.Winner != 1 || g.GameOverReason != ReasonFirstCapture {
+		t.Fatalf("after the first capture: over %v, winner %d by %q", g.GameOver, g.Winner, g.GameOverReason)
+	}
+}
+
+func TestClone(t *testing.T) {
+	rules := testRules()
+	rules.TurnOrder = []int{0, 1}
+	g := newTestGame(rules)
+	mustMove(t, g, "P1", "B", 0)
+	mustMove(t, g, "P1", "F", 1)
+	mustMove(t, g, "P1", "B", 0)
+	before, moves := g.positionKey(), len(g.Moves)
+
+	clone := g.Clone()
+	if clone.positionKey() != before {
+		t.Fatal("clone starts from a different position")
+	}
+	// Player 1 takes player 0's P1 on the clone
+	mustMove(t, clone, "P1", "F", 1)
+	if err := clone.Annotate(1, 0, "on the clone"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.positionKey() != before || len(g.Moves) != moves || g.CurrentPlayer != 1 {
+		t.Fatalf("moving on the clone changed the original: %d moves, player %d to move", len(g.Moves), g.CurrentPlayer)
+	}
+	if p1 := g.FindCharacter("P1", 0); p1 == nil || g.Board[2][0] != p1 || len(g.Players[0].Characters) != 5 {
+		t.Fatal("capture on the clone took the original's piece")
+	}
+	if len(g.Moves[0].Comments) != 0 {
+		t.Error("comment on the clone was added to the original")
+	}
+	mustMove(t, g, "P3", "F", 1)
+	if clone.FindCharacter("P3", 1).Y != 4 {
+		t.Error("moving on the original changed the clone")
+	}
+	clone.Rules.TurnOrder[0] = 1
+	if g.Rules.TurnOrder[0] != 0 {
+		t.Error("changing the clone's turn order changed the original's")
+	}
+}
+
+func TestHeroPathOffBoard(t *testing.T) {
+	rules := Rules{BoardWidth: 3, BoardHeight: 3, Pieces: []string{"Hero1", "Pawn", "Hero2"}}
+	g := newPosition(t, rules,
+		Character{Type: "Hero1", Name: "H1", X: 1, Y: 0, Owner: 0},
+		Character{Type: "Hero2", Name: "H3", X: 2, Y: 1, Owner: 0},
+		Character{Type: "Pawn", Name: "P2", X: 0, Y: 2, Owner: 1},
+	)
+	noTrace := func(string, ...any) {}
+	for _, tt := range []struct {
+		name, direction string
+	}{
+		// The square H1 passes is on the board but its landing square isn't
+		{"H1", "R"},
+		{"H1", "L"},
+		// Both are off the board
+		{"H1", "F"},
+		// H3 passes (2,0) on its way off the board
+		{"H3", "FR"},
+	} {
+		char := g.FindCharacter(tt.name, 0)
+		if err := g.CheckMove(char, tt.direction, noTrace); !errors.Is(err, ErrOutOfBounds) {
+			t.Errorf("%s %s: got %v, want ErrOutOfBounds", tt.name, tt.direction, err)
+		}
+	}
+	if got := g.LegalDirections(g.FindCharacter("H1", 0)); !slices.Equal(got, []string{"B"}) {
+		t.Errorf("H1 can move %v, want only B", got)
+	}
+}
+
+func TestMultiCapture(t *testing.T) {
+	g := newPosition(t, testRules(),
+		Character{Type: "Hero1", Name: "H2", X: 1, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 1, Y: 1, Owner: 1},
+		Character{Type: "Pawn", Name: "P3", X: 1, Y: 2, Owner: 1},
+		Character{Type: "Pawn", Name: "P5", X: 4, Y: 4, Owner: 1},
+	)
+	mustMove(t, g, "H2", "B", 0)
+	move := g.Moves[0]
+	if !move.MultiCapture || !sameElements(move.Captured, []string{"P1", "P3"}) {
+		t.Fatalf("hero capturing on its path and landing square recorded as %+v", move)
+	}
+
+	mustMove(t, g, "P5", "F", 1)
+	mustMove(t, g, "H2", "B", 0)
+	if g.Moves[2].MultiCapture {
+		t.Fatalf("move capturing nothing recorded as a multi-capture: %+v", g.Moves[2])
+	}
+}
+
+func TestTurnOrder(t *testing.T) {
+	rules := testRules()
+	rules.TurnOrder = []int{1, 0}
+	rules.AllowPass = true
+	g := newTestGame(rules)
+	if g.FirstPlayer != 1 || g.CurrentPlayer != 1 {
+		t.Fatalf("game starts with player %d first and player %d to move, want player 1", g.FirstPlayer, g.CurrentPlayer)
+	}
+
+	// Moves and passes alike hand the turn on in the rules' order
+	var turns []int
+	for _, move := range []Move{{CharacterName: "P1", Direction: "F"}, {CharacterName: "P1", Direction: "B"}, {}, {CharacterName: "P3", Direction: "B"}} {
+		turns = append(turns, g.CurrentPlayer)
+		if move.CharacterName == "" {
+			if err := g.ProcessPass(g.CurrentPlayer); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		mustMove(t, g, move.CharacterName, move.Direction, g.CurrentPlayer)
+	}
+	if want := []int{1, 0, 1, 0}; !slices.Equal(turns, want) || g.CurrentPlayer != 1 {
+		t.Fatalf("players took turns %v with player %d to move next, want %v then player 1", turns, g.CurrentPlayer, want)
+	}
+	if g.Moves[2].Player != 1 || !g.Moves[2].Pass {
+		t.Errorf("third move %+v, want player 1's pass", g.Moves[2])
+	}
+}
+
+func TestImmobilizedLoses(t *testing.T) {
+	for _, loses := range []bool{false, true} {
+		// Every move of player 1's hero leaves a board this small
+		rules := Rules{BoardWidth: 3, BoardHeight: 2, Pieces: []string{"Pawn", "Hero1", "Pawn"}, ImmobilizedLoses: loses}
+		g := newPosition(t, rules,
+			Character{Type: "Pawn", Name: "P1", X: 0, Y: 0, Owner: 0},
+			Character{Type: "Hero1", Name: "H2", X: 1, Y: 1, Owner: 1},
+		)
+		mustMove(t, g, "P1", "B", 0)
+
+		winner, reason := NoWinner, ReasonDrawStalemate
+		if loses {
+			winner, reason = 0, ReasonImmobilized
+		}
+		if !g.GameOver || g.Winner != winner || g.GameOverReason != reason {
+			t.Errorf("immobilized loses %v: over %v, winner %d by %q, want %d by %q", loses, g.GameOver, g.Winner, g.GameOverReason, winner, reason)
+		}
+	}
+}
+
+func TestCaptures(t *testing.T) {
+	g := newPosition(t, testRules(),
+		Character{Type: "Hero1", Name: "H2", X: 1, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 1, Y: 1, Owner: 1},
+		Character{Type: "Hero2", Name: "H4", X: 1, Y: 2, Owner: 1},
+		Character{Type: "Pawn", Name: "P5", X: 4, Y: 4, Owner: 1},
+	)
+	mustMove(t, g, "H2", "B", 0)
+	mustMove(t, g, "P5", "F", 1)
+	want := []CapturedPiece{{Name: "P1", Type: "Pawn"}, {Name: "H4", Type: "Hero2"}}
+	captures := g.Captures()
+	if !slices.Equal(captures[0], want) || len(captures[1]) != 0 {
+		t.Fatalf("got captures %+v, want %+v for player 0 and none for player 1", captures, want)
+	}
+
+	// Trimming the move that made them doesn't lose them
+	mustMove(t, g, "H2", "B", 0)
+	g.TrimHistory(1)
+	if g.Trimmed != 1 {
+		t.Fatalf("trimmed %d moves, want 1", g.Trimmed)
+	}
+	if captures := g.Captures(); !slices.Equal(captures[0], want) {
+		t.Fatalf("after trimming got captures %+v, want %+v", captures[0], want)
+	}
+
+}
@@ -0,0 +1,40 @@
+package engine
+
+// MinHistory is the fewest moves TrimHistory keeps, so that a player's
+// previous move can still be found to reject a takeback
+const MinHistory = 2
+
+// MoveCount is the number of moves played, including those trimmed from
+// Moves
+func (g *Game) MoveCount() int {
+	return g.Trimmed + len(g.Moves)
+}
+
+// TrimHistory drops the n oldest moves from Moves, along with the positions
+// reached before them. The positions go on counting towards repetitions, and
+// the pieces captured towards the captures, but the moves themselves are
+// gone, so callers that need the whole game must keep them first. It must
+// leave at least MinHistory moves.
+func (g *Game) TrimHistory(n int) {
+	n = min(n, len(g.Moves)-MinHistory, len(g.PositionHistory)-1)
+	if n <= 0 {
+		return
+	}
+	if g.trimmedPositions == nil {
+		g.trimmedPositions = make(map[string]int)
+	}
+	for i, move := range g.Moves[:n] {
+		g.trimmedPositions[g.PositionHistory[i]]++
+		if len(move.Captured) > 0 && g.Rules.RespawnTurns == 0 {
+			// Without respawns pieces only ever leave the board, so no
+			// position from before a capture can come up again
+			clear(g.trimmedPositions)
+		}
+		for j, name := range move.Captured {
+			g.trimmedCaptures[move.Player] = append(g.trimmedCaptures[move.Player], CapturedPiece{Name: name, Type: move.CapturedTypes[j]})
+		}
+	}
+	g.Moves = append([]MoveRecord(nil), g.Moves[n:]...)
+	g.PositionHistory = append([]string(nil), g.PositionHistory[n:]...)
+	g.Trimmed += n
+}
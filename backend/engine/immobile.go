@@ -0,0 +1,48 @@
+package engine
+
+import "errors"
+
+// permanentlyImmobilized reports whether none of a player's pieces can ever
+// move again, as opposed to having no legal move just this turn. It errs
+// towards no: every move of every piece must be off the board, or onto or
+// through a friendly piece that can't be pushed aside. The friendly pieces
+// are stuck as well, so only the opponent removing one could free them, and
+// the opponent must never be able to capture, now or once pieces respawn.
+// The player must have no pieces waiting to respawn either.
+func (g *Game) permanentlyImmobilized(playerID int) bool {
+	if len(g.Players[playerID].Characters) == 0 || len(g.Respawns) > 0 {
+		return false
+	}
+	walled := false
+	for _, char := range g.Players[playerID].Characters {
+		for _, direction := range Directions {
+			if x, y := CalculateNewPosition(char, direction); x == char.X && y == char.Y {
+				// Not a direction this piece moves in
+				continue
+			}
+			err := g.validateMove(char, direction)
+			switch {
+			case errors.Is(err, ErrIllegalDirection), errors.Is(err, ErrOutOfBounds):
+			case errors.Is(err, ErrBlockedByFriendly) && !g.canPush(char):
+				walled = true
+			default:
+				return false
+			}
+		}
+	}
+	return !walled || !g.opponentCanCapture(playerID)
+}
+
+// opponentCanCapture reports whether the opponent of a player has a piece
+// able to capture
+func (g *Game) opponentCanCapture(playerID int) bool {
+	if g.Rules.RacePiece != "" {
+		return false
+	}
+	for _, char := range g.Players[(playerID+1)%2].Characters {
+		if g.canCapture(char) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package engine
+
+// kingOf returns a player's king, or nil if it has been captured or the king
+// variant is off
+func (g *Game) kingOf(playerID int) *Character {
+	if g.Rules.King == "" {
+		return nil
+	}
+	for _, char := range g.Players[playerID].Characters {
+		if char.Type == g.Rules.King {
+			return char
+		}
+	}
+	return nil
+}
+
+// kingCaptured reports whether the king variant is on and a player has lost
+// their king
+func (g *Game) kingCaptured(playerID int) bool {
+	return g.Rules.King != "" && g.kingOf(playerID) == nil
+}
+
+// kingAttacked reports whether the opponent could capture a player's king
+// with their next move, whether by landing on it or, for a hero, passing it.
+// Each move is played on the board and rolled back, as Threats does.
+func (g *Game) kingAttacked(playerID int) bool {
+	if g.kingOf(playerID) == nil {
+		return false
+	}
+	opponent := (playerID + 1) % 2
+	for _, move := range g.candidateMoves(opponent) {
+		snap := g.takeSnapshot()
+		g.moveCharacter(g.FindCharacter(move.CharacterName, opponent), move.Direction)
+		captured := g.kingOf(playerID) == nil
+		g.restoreSnapshot(snap)
+		if captured {
+			return true
+		}
+	}
+	return false
+}
+
+// exposesKing reports whether a move would leave the mover's king open to
+// capture. The move is played on the board and rolled back.
+func (g *Game) exposesKing(move Move, playerID int) bool {
+	snap := g.takeSnapshot()
+	defer g.restoreSnapshot(snap)
+	g.moveCharacter(g.FindCharacter(move.CharacterName, playerID), move.Direction)
+	return g.kingAttacked(playerID)
+}
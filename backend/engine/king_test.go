@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestKingSafety(t *testing.T) {
+	rules := testRules()
+	rules.King = "Hero2"
+	rules.KingSafety = true
+	g := newPosition(t, rules,
+		Character{Type: "Hero2", Name: "H4", X: 2, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 1, Y: 3, Owner: 1},
+		Character{Type: "Hero2", Name: "H4", X: 4, Y: 3, Owner: 1},
+	)
+
+	// BL lands where the pawn could take the king
+	bl, br := Move{CharacterName: "H4", Direction: "BL"}, Move{CharacterName: "H4", Direction: "BR"}
+	if moves := g.LegalMoves(0); slices.Contains(moves, bl) || !slices.Contains(moves, br) {
+		t.Fatalf("legal moves %v, want BR but not BL", moves)
+	}
+	if err := g.ProcessMove(bl, 0); err == nil {
+		t.Fatal("move exposing the king was accepted")
+	}
+	mustMove(t, g, "H4", "BR", 0)
+}
+
+func TestKingCaptured(t *testing.T) {
+	rules := testRules()
+	rules.King = "Hero2"
+	g := newPosition(t, rules,
+		Character{Type: "Hero2", Name: "H4", X: 2, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 1, Y: 3, Owner: 1},
+		Character{Type: "Hero2", Name: "H4", X: 4, Y: 3, Owner: 1},
+	)
+	mustMove(t, g, "H4", "BL", 0)
+	mustMove(t, g, "P1", "F", 1)
+	if !g.GameOver || g.Winner != 1 || g.GameOverReason != ReasonKingCaptured {
+		t.Fatalf("after losing the king: over %v, winner %d, reason %q", g.GameOver, g.Winner, g.GameOverReason)
+	}
+}
+
+func TestKingSafetyHeroPassing(t *testing.T) {
+	rules := testRules()
+	rules.King = "Pawn"
+	rules.KingSafety = true
+	position := []Character{
+		{Type: "Pawn", Name: "P1", X: 2, Y: 2, Owner: 0},
+		{Type: "Hero1", Name: "H2", X: 0, Y: 0, Owner: 0},
+		{Type: "Hero2", Name: "H4", X: 2, Y: 3, Owner: 1},
+		{Type: "Pawn", Name: "P5", X: 4, Y: 4, Owner: 1},
+	}
+
+	// H4 can take the king by passing it on the way to (1,1), so a move
+	// elsewhere leaves it exposed
+	g := newPosition(t, rules, position...)
+	if err := g.ProcessMove(Move{CharacterName: "H2", Direction: "R"}, 0); err == nil {
+		t.Fatal("move leaving the king to be passed was accepted")
+	}
+	mustMove(t, g, "P1", "L", 0)
+
+	// Without king safety the hero takes it
+	rules.KingSafety = false
+	g = newPosition(t, rules, position...)
+	mustMove(t, g, "H2", "R", 0)
+	mustMove(t, g, "H4", "FL", 1)
+	if !g.GameOver || g.Winner != 1 || g.GameOverReason != ReasonKingCaptured {
+		t.Fatalf("after the king was passed: over %v, winner %d, reason %q", g.GameOver, g.Winner, g.GameOverReason)
+	}
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// arrangement returns a copy of where a player's pieces stand
+func (g *Game) arrangement(playerID int) []Character {
+	pieces := make([]Character, len(g.Players[playerID].Characters))
+	for i, char := range g.Players[playerID].Characters {
+		pieces[i] = *char
+	}
+	return pieces
+}
+
+// NewReplay sets up a game that has already started from a recorded start
+// position, for its moves to be played again with Replay
+func NewReplay(rules Rules, start [2][]Character, firstPlayer int) (*Game, error) {
+	if firstPlayer != 0 && firstPlayer != 1 {
+		return nil, fmt.Errorf("first player must be 0 or 1, not %d", firstPlayer)
+	}
+	if start[0] == nil || start[1] == nil {
+		return nil, errors.New("no start position recorded")
+	}
+	game := &Game{
+		Board:         make([][]*Character, rules.BoardHeight),
+		CurrentPlayer: firstPlayer,
+		FirstPlayer:   firstPlayer,
+		Ready:         [2]bool{true, true},
+		Started:       true,
+		Start:         start,
+		Rules:         rules,
+	}
+	for y := range game.Board {
+		game.Board[y] = make([]*Character, rules.BoardWidth)
+	}
+	for playerID, pieces := range start {
+		game.Players[playerID] = &Player{
+			ID:         playerID,
+			Name:       fmt.Sprintf("Player %d", playerID+1),
+			Characters: make([]*Character, 0, len(pieces)),
+		}
+		for _, piece := range pieces {
+			if !game.inBounds(piece.X, piece.Y) {
+				return nil, fmt.Errorf("%s of player %d starts off the board", piece.Name, playerID)
+			}
+			if game.Board[piece.Y][piece.X] != nil {
+				return nil, fmt.Errorf("%s of player %d starts on an occupied square", piece.Name, playerID)
+			}
+			char := piece
+			char.Owner = playerID
+			game.Players[playerID].Characters = append(game.Players[playerID].Characters, &char)
+			game.Board[char.Y][char.X] = &char
+		}
+	}
+	game.PositionHistory = []string{game.positionKey()}
+	return game, nil
+}
+
+// Replay plays a recorded move again. The turn is given to the player who
+// made it, since the moves of a simultaneous game's round are recorded one
+// after the other.
+func (g *Game) Replay(move MoveRecord) error {
+	if g.GameOver {
+		return ErrGameOver
+	}
+	if move.Player != 0 && move.Player != 1 {
+		return fmt.Errorf("no such player: %d", move.Player)
+	}
+	g.CurrentPlayer = move.Player
+	switch {
+	case move.Pass:
+		return g.ProcessPass(move.Player)
+	case move.Swap != "":
+		return g.ProcessSwap(move.Character, move.Swap, move.Player)
+	}
+	return g.ProcessMove(Move{CharacterName: move.Character, Direction: move.Direction}, move.Player)
+}
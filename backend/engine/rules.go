@@ -0,0 +1,64 @@
+package engine
+
+// Rules are the settings a game is played by
+type Rules struct {
+	BoardWidth  int
+	BoardHeight int
+	// Pieces are the piece types each player starts with
+	Pieces []string
+	// Columns are the home-row columns the pieces start on, in the order of
+	// Pieces. Without them the pieces fill the leftmost columns.
+	Columns []int
+	// RandomPlacement shuffles the order of each player's home row
+	RandomPlacement bool
+	// CustomSetup lets players arrange their own home row before the start
+	CustomSetup bool
+
+	// RacePiece, if set, turns off captures and makes the game a race to
+	// get a piece of this type onto the opponent's home row
+	RacePiece string
+	// FirstCapture makes the game sudden death, won by the first capture
+	FirstCapture bool
+	// Simultaneous has both players move at once each round, as described
+	// in simultaneous.go
+	Simultaneous bool
+	// TurnOrder, if set, is the order the players take turns in, by ID. It
+	// must name each player once, and the first game starts with its first.
+	TurnOrder []int
+	// King, if set, is the piece type whose capture loses the game.
+	// KingSafety forbids moves leaving a player's king open to capture.
+	King       string
+	KingSafety bool
+
+	// Strict rejects moves and swaps that leave the board unchanged
+	Strict bool
+	// NoTakeback rejects a move undoing the player's previous move
+	NoTakeback bool
+	AllowSwap  bool
+	AllowPass  bool
+	// HeroPush lets a hero shove a friendly piece off its landing square
+	HeroPush bool
+	// Guarding makes a piece immune to capture while a friendly piece
+	// stands directly behind it, as seen from the attacker
+	Guarding bool
+	// NoHero2Jump blocks a Hero2 by a friendly piece on the square it passes
+	NoHero2Jump bool
+	// NonCapturing lists the piece types that cannot capture
+	NonCapturing []string
+	// RespawnTurns, if set, returns captured pieces to their home row this
+	// many moves after their capture
+	RespawnTurns int
+
+	// MaxMoves, if set, ends the game once this many moves have been played.
+	// It is drawn unless CaptureTiebreak is set and one player has captured
+	// more.
+	MaxMoves        int
+	CaptureTiebreak bool
+	// ImmobilizedLoses makes a player without a legal move lose, rather
+	// than draw by stalemate, if their pieces can never move again, as
+	// decided by permanentlyImmobilized
+	ImmobilizedLoses bool
+
+	// PieceValues weights each piece type when counting material
+	PieceValues map[string]int
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// homeRow is the row a player's pieces start on
+func (g *Game) homeRow(playerID int) int {
+	if playerID == 1 {
+		return len(g.Board) - 1
+	}
+	return 0
+}
+
+// ApplySetup replaces a player's starting pieces with the given arrangement.
+// The setup must use exactly the game's pieces, each on its own square of
+// the player's home row.
+func (g *Game) ApplySetup(playerID int, pieces []SetupPiece) error {
+	if !g.Rules.CustomSetup {
+		return errors.New("custom setups are not allowed")
+	}
+	if g.Started {
+		return errors.New("the game has already started")
+	}
+
+	want := make(map[string]int)
+	for _, charType := range g.Rules.Pieces {
+		want[charType]++
+	}
+	row := g.homeRow(playerID)
+	taken := make(map[int]bool)
+	for _, piece := range pieces {
+		if piece.Y != row {
+			return fmt.Errorf("%s is placed outside your home row", piece.Type)
+		}
+		if piece.X < 0 || piece.X >= len(g.Board[row]) {
+			return fmt.Errorf("%s is placed off the board at column %d", piece.Type, piece.X)
+		}
+		if taken[piece.X] {
+			return fmt.Errorf("two pieces are placed at column %d", piece.X)
+		}
+		taken[piece.X] = true
+		if want[piece.Type] == 0 {
+			return fmt.Errorf("setup has too many %s pieces", piece.Type)
+		}
+		want[piece.Type]--
+	}
+	for charType, n := range want {
+		if n > 0 {
+			return fmt.Errorf("setup is missing %d %s pieces", n, charType)
+		}
+	}
+
+	for _, char := range g.Players[playerID].Characters {
+		g.Board[char.Y][char.X] = nil
+	}
+	g.Players[playerID].Characters = make([]*Character, 0, len(pieces))
+	for _, piece := range pieces {
+		char := &Character{
+			Type:  piece.Type,
+			Name:  fmt.Sprintf("%s%d", piece.Type[:1], piece.X+1),
+			X:     piece.X,
+			Y:     piece.Y,
+			Owner: playerID,
+		}
+		g.Players[playerID].Characters = append(g.Players[playerID].Characters, char)
+		g.Board[char.Y][char.X] = char
+	}
+	g.Start[playerID] = g.arrangement(playerID)
+	g.changed()
+	g.PositionHistory = []string{g.positionKey()}
+	return nil
+}
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSetupOnHomeRow(t *testing.T) {
+	rules := testRules()
+	rules.CustomSetup = true
+	g := NewGame(rand.New(rand.NewSource(1)), rules)
+
+	offRow := []SetupPiece{
+		{Type: "Hero1", X: 0, Y: 0}, {Type: "Pawn", X: 1, Y: 0}, {Type: "Pawn", X: 2, Y: 1},
+		{Type: "Hero2", X: 3, Y: 0}, {Type: "Pawn", X: 4, Y: 0},
+	}
+	if err := g.ApplySetup(0, offRow); err == nil {
+		t.Fatal("setup with a piece off the home row was accepted")
+	}
+	missing := []SetupPiece{
+		{Type: "Hero1", X: 0, Y: 0}, {Type: "Pawn", X: 1, Y: 0}, {Type: "Pawn", X: 2, Y: 0},
+		{Type: "Hero2", X: 3, Y: 0},
+	}
+	if err := g.ApplySetup(0, missing); err == nil {
+		t.Fatal("setup missing a pawn was accepted")
+	}
+
+	// Player 1's home row is the last one
+	setup := []SetupPiece{
+		{Type: "Hero1", X: 0, Y: 4}, {Type: "Pawn", X: 1, Y: 4}, {Type: "Pawn", X: 2, Y: 4},
+		{Type: "Hero2", X: 3, Y: 4}, {Type: "Pawn", X: 4, Y: 4},
+	}
+	if err := g.ApplySetup(1, setup); err != nil {
+		t.Fatal(err)
+	}
+	if h := g.FindCharacter("H1", 1); h == nil || h.Type != "Hero1" || g.Board[4][0] != h {
+		t.Fatalf("after the setup player 1 has %+v", g.Players[1].Characters)
+	}
+
+	g.Started = true
+	if err := g.ApplySetup(1, setup); err == nil {
+		t.Fatal("setup after the start was accepted")
+	}
+}
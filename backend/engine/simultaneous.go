@@ -0,0 +1,92 @@
+package engine
+
+import "fmt"
+
+// In a simultaneous game each round both players choose a move without
+// seeing the other's, and the two are played together once both are in. Each
+// move is checked when it is submitted, against the position the round
+// started from. The round is then resolved:
+//
+//   - If both pieces would land on the same square they collide, and neither
+//     move is played.
+//   - Otherwise the moves are played one after the other, that of the player
+//     with priority first. A second move made illegal by the first, say
+//     because its piece was captured, is dropped.
+//
+// Priority is held by the current player. The first player has it in the
+// first round, and it passes to the other player every round.
+
+// Round reports how a round of a simultaneous game was resolved
+type Round struct {
+	Priority int `json:"priority"`
+	// Moves are those played, in the order they were played
+	Moves   []MoveRecord  `json:"moves"`
+	Dropped []DroppedMove `json:"dropped,omitempty"`
+}
+
+// DroppedMove is a submitted move that the round's resolution left unplayed
+type DroppedMove struct {
+	Player int `json:"player"`
+	Move
+	Reason string `json:"reason"`
+	Code   string `json:"code,omitempty"`
+}
+
+// SubmitMove takes a player's move for the current round, checking it against
+// the position the round started from
+func (g *Game) SubmitMove(move Move, playerID int) error {
+	if g.Pending[playerID] != nil {
+		return ErrAlreadySubmitted
+	}
+	character := g.FindCharacter(move.CharacterName, playerID)
+	if character == nil {
+		return fmt.Errorf("%w: %s", ErrInvalidCharacter, move.CharacterName)
+	}
+	if err := g.validateMove(character, move.Direction); err != nil {
+		return fmt.Errorf("invalid move: %s %s: %w", move.CharacterName, move.Direction, err)
+	}
+	g.Pending[playerID] = &move
+	return nil
+}
+
+// ResolveRound plays the moves both players have submitted for the round and
+// passes priority on
+func (g *Game) ResolveRound() Round {
+	first := g.CurrentPlayer
+	second := g.nextPlayer(first)
+	moves := [2]Move{*g.Pending[0], *g.Pending[1]}
+	g.Pending = [2]*Move{}
+	round := Round{Priority: first, Moves: make([]MoveRecord, 0, 2)}
+
+	a := g.FindCharacter(moves[first].CharacterName, first)
+	b := g.FindCharacter(moves[second].CharacterName, second)
+	ax, ay := CalculateNewPosition(a, moves[first].Direction)
+	bx, by := CalculateNewPosition(b, moves[second].Direction)
+	if ax == bx && ay == by {
+		for _, playerID := range []int{first, second} {
+			round.Dropped = append(round.Dropped, droppedMove(playerID, moves[playerID], ErrCollision))
+		}
+		g.CurrentPlayer = second
+		return round
+	}
+
+	for _, playerID := range []int{first, second} {
+		if g.GameOver {
+			break
+		}
+		g.CurrentPlayer = playerID
+		if err := g.ProcessMove(moves[playerID], playerID); err != nil {
+			round.Dropped = append(round.Dropped, droppedMove(playerID, moves[playerID], err))
+			continue
+		}
+		round.Moves = append(round.Moves, g.Moves[len(g.Moves)-1])
+	}
+	if !g.GameOver {
+		g.CurrentPlayer = second
+	}
+	return round
+}
+
+func droppedMove(playerID int, move Move, err error) DroppedMove {
+	return DroppedMove{Player: playerID, Move: move, Reason: err.Error(), Code: ErrorCode(err)}
+}
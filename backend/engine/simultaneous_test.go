@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+// playRound submits a move for each player and resolves the round, failing
+// the test if either move is rejected
+func playRound(t *testing.T, g *Game, move0, move1 Move) Round {
+	t.Helper()
+	for playerID, move := range []Move{move0, move1} {
+		if err := g.SubmitMove(move, playerID); err != nil {
+			t.Fatalf("player %d %s %s: %v", playerID, move.CharacterName, move.Direction, err)
+		}
+	}
+	return g.ResolveRound()
+}
+
+func TestSimultaneousRounds(t *testing.T) {
+	rules := testRules()
+	rules.Simultaneous = true
+	g := newTestGame(rules)
+
+	if err := g.SubmitMove(Move{CharacterName: "P1", Direction: "L"}, 0); !errors.Is(err, ErrOutOfBounds) {
+		t.Fatalf("move off the board submitted: got %v, want ErrOutOfBounds", err)
+	}
+	round := playRound(t, g, Move{CharacterName: "P1", Direction: "B"}, Move{CharacterName: "P1", Direction: "F"})
+	if round.Priority != 0 || len(round.Moves) != 2 || round.Moves[0].Player != 0 || len(round.Dropped) != 0 {
+		t.Fatalf("first round: got %+v, want both moves played, player 0's first", round)
+	}
+	if g.CurrentPlayer != 1 {
+		t.Fatalf("priority passed to player %d, want 1", g.CurrentPlayer)
+	}
+
+	if err := g.SubmitMove(Move{CharacterName: "P3", Direction: "B"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.SubmitMove(Move{CharacterName: "P1", Direction: "B"}, 0); !errors.Is(err, ErrAlreadySubmitted) {
+		t.Fatalf("second move for the round: got %v, want ErrAlreadySubmitted", err)
+	}
+	g.Pending = [2]*Move{}
+
+	// Both heroes land on (1,2), so neither moves
+	round = playRound(t, g, Move{CharacterName: "H2", Direction: "B"}, Move{CharacterName: "H2", Direction: "F"})
+	if round.Priority != 1 || len(round.Moves) != 0 || len(round.Dropped) != 2 || round.Dropped[0].Code != ErrorCode(ErrCollision) {
+		t.Fatalf("colliding round: got %+v, want both moves dropped as a collision", round)
+	}
+	if h2 := g.FindCharacter("H2", 0); h2.Y != 0 || len(g.Moves) != 2 || g.CurrentPlayer != 0 {
+		t.Fatalf("collision moved H2 to row %d, left %d moves and player %d with priority", h2.Y, len(g.Moves), g.CurrentPlayer)
+	}
+}
+
+func TestSimultaneousMoveDropped(t *testing.T) {
+	rules := testRules()
+	rules.Simultaneous = true
+	g := newPosition(t, rules,
+		Character{Type: "Pawn", Name: "P1", X: 2, Y: 1, Owner: 0},
+		Character{Type: "Pawn", Name: "P3", X: 0, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 2, Y: 2, Owner: 1},
+		Character{Type: "Pawn", Name: "P3", X: 4, Y: 4, Owner: 1},
+	)
+
+	// Player 0 has priority and captures the pawn player 1 chose to move
+	round := playRound(t, g, Move{CharacterName: "P1", Direction: "B"}, Move{CharacterName: "P1", Direction: "R"})
+	if len(round.Moves) != 1 || round.Moves[0].Player != 0 {
+		t.Fatalf("got moves %+v, want only player 0's", round.Moves)
+	}
+	if len(round.Dropped) != 1 || round.Dropped[0].Player != 1 {
+		t.Fatalf("got dropped moves %+v, want player 1's", round.Dropped)
+	}
+	if g.FindCharacter("P1", 1) != nil {
+		t.Error("player 1's P1 was not captured")
+	}
+}
@@ -0,0 +1,50 @@
+package engine
+
+import "strings"
+
+// isTakeback reports whether moving char has just undone the player's
+// previous move: the piece went straight back to the square it left, and the
+// player's pieces stand exactly where they stood before that move. The
+// opponent's reply in between isn't taken into account. It is called after
+// the move has been made but before it is recorded.
+func (g *Game) isTakeback(char *Character, playerID int) bool {
+	for i := len(g.Moves) - 1; i >= 0; i-- {
+		last := g.Moves[i]
+		if last.Player != playerID {
+			continue
+		}
+		if last.Pass || last.Swap != "" || last.Character != char.Name {
+			return false
+		}
+		if char.X != last.From.X || char.Y != last.From.Y || i >= len(g.PositionHistory) {
+			return false
+		}
+		return ownPieces(g.PositionHistory[i], playerID) == ownPieces(g.positionKey(), playerID)
+	}
+	return false
+}
+
+// undoesMove reports whether a move would be a takeback. The move is played
+// on the board and rolled back.
+func (g *Game) undoesMove(move Move, playerID int) bool {
+	snap := g.takeSnapshot()
+	defer g.restoreSnapshot(snap)
+	char := g.FindCharacter(move.CharacterName, playerID)
+	g.moveCharacter(char, move.Direction)
+	return g.isTakeback(char, playerID)
+}
+
+// ownPieces reduces a position key to the squares holding one player's
+// pieces
+func ownPieces(key string, playerID int) string {
+	cells := strings.Split(key, ",")
+	// The last field is the player to move
+	cells = cells[:len(cells)-1]
+	owner := string(rune('0' + playerID))
+	for i, cell := range cells {
+		if !strings.HasPrefix(cell, owner) {
+			cells[i] = "."
+		}
+	}
+	return strings.Join(cells, ",")
+}
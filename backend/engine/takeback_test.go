@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNoTakeback(t *testing.T) {
+	rules := testRules()
+	rules.NoTakeback = true
+	g := newTestGame(rules)
+	mustMove(t, g, "P1", "B", 0)
+	mustMove(t, g, "P1", "F", 1)
+
+	back := Move{CharacterName: "P1", Direction: "F"}
+	if slices.Contains(g.LegalMoves(0), back) {
+		t.Fatal("legal moves include taking back P1")
+	}
+	if err := g.ProcessMove(back, 0); !errors.Is(err, ErrTakeback) {
+		t.Fatalf("taking back P1: got %v, want %v", err, ErrTakeback)
+	}
+	if p1 := g.FindCharacter("P1", 0); p1.Y != 1 || g.CurrentPlayer != 0 {
+		t.Fatalf("rejected takeback left P1 on row %d with player %d to move", p1.Y, g.CurrentPlayer)
+	}
+
+	// Once another piece has moved, P1 may go back
+	mustMove(t, g, "P3", "B", 0)
+	mustMove(t, g, "P3", "F", 1)
+	mustMove(t, g, "P1", "F", 0)
+}
@@ -0,0 +1,41 @@
+package engine
+
+// Threats maps, row by row like the board, the cells where the opponent of a
+// player could capture with their next move. A cell holding one of the
+// player's pieces is threatened if a move legal for the opponent now would
+// capture it. An empty cell is threatened if an opponent piece that captures
+// could land on it, so that a piece moved there would be open to capture.
+// Cells holding the opponent's own pieces never are.
+func (g *Game) Threats(playerID int) [][]bool {
+	threats := make([][]bool, len(g.Board))
+	for y, row := range g.Board {
+		threats[y] = make([]bool, len(row))
+	}
+	if g.Rules.RacePiece != "" {
+		return threats
+	}
+
+	opponent := (playerID + 1) % 2
+	for _, move := range g.LegalMoves(opponent) {
+		char := g.FindCharacter(move.CharacterName, opponent)
+		x, y := CalculateNewPosition(char, move.Direction)
+		if g.Board[y][x] == nil && g.canCapture(char) {
+			threats[y][x] = true
+		}
+
+		// Play the move to see which of the player's pieces it takes
+		snap := g.takeSnapshot()
+		g.moveCharacter(char, move.Direction)
+		remaining := make(map[*Character]bool)
+		for _, piece := range g.Players[playerID].Characters {
+			remaining[piece] = true
+		}
+		g.restoreSnapshot(snap)
+		for _, piece := range g.Players[playerID].Characters {
+			if !remaining[piece] {
+				threats[piece.Y][piece.X] = true
+			}
+		}
+	}
+	return threats
+}
@@ -0,0 +1,33 @@
+package engine
+
+import "testing"
+
+func TestThreats(t *testing.T) {
+	g := newPosition(t, testRules(),
+		Character{Type: "Pawn", Name: "P1", X: 2, Y: 1, Owner: 0},
+		Character{Type: "Pawn", Name: "P3", X: 4, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 2, Y: 2, Owner: 1},
+		Character{Type: "Hero1", Name: "H2", X: 0, Y: 4, Owner: 1},
+	)
+	want := map[Square]bool{
+		// Player 1's pawn can step to either side or back, or take P1
+		{X: 1, Y: 2}: true, {X: 3, Y: 2}: true, {X: 2, Y: 3}: true, {X: 2, Y: 1}: true,
+		// Its hero can go two right or two forward, but the squares it
+		// passes over aren't threatened
+		{X: 2, Y: 4}: true, {X: 0, Y: 2}: true,
+	}
+	threats := g.Threats(0)
+	for y, row := range threats {
+		for x, threatened := range row {
+			if threatened != want[Square{X: x, Y: y}] {
+				t.Errorf("cell (%d,%d) threatened %v, want %v", x, y, threatened, !threatened)
+			}
+		}
+	}
+
+	// For player 1 it's the other way round: its pawn is open to capture,
+	// and the opponent's own pawn never counts as threatened
+	if threats := g.Threats(1); !threats[2][2] || threats[1][2] {
+		t.Errorf("player 1's threats: pawn on (2,2) %v, player 0's pawn on (2,1) %v", threats[2][2], threats[1][2])
+	}
+}
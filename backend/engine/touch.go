@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+)
+
+// TouchBound returns the piece the player to move has touched and so must
+// move, or nil if they are free to move any piece. A touched piece with no
+// legal move does not bind the player.
+func (g *Game) TouchBound() *Character {
+	if g.Touched == "" {
+		return nil
+	}
+	char := g.FindCharacter(g.Touched, g.CurrentPlayer)
+	if char == nil || len(g.LegalDirections(char)) == 0 {
+		return nil
+	}
+	return char
+}
+
+// checkTouchMove rejects a turn that does not move the touched piece, if the
+// player to move is bound to it. names are the pieces the turn moves.
+func (g *Game) checkTouchMove(names ...string) error {
+	char := g.TouchBound()
+	if char == nil || slices.Contains(names, char.Name) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrTouchMove, char.Name)
+}
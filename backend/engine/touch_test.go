@@ -0,0 +1,32 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTouchedPieceWithoutMoves(t *testing.T) {
+	g := newPosition(t, testRules(),
+		Character{Type: "Pawn", Name: "P1", X: 0, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P2", X: 0, Y: 1, Owner: 0},
+		Character{Type: "Hero1", Name: "H2", X: 1, Y: 0, Owner: 0},
+		Character{Type: "Pawn", Name: "P1", X: 4, Y: 4, Owner: 1},
+	)
+
+	// P1 is boxed in by its own pieces, so touching it binds no one
+	g.Touched = "P1"
+	if g.TouchBound() != nil {
+		t.Fatal("touched piece with no legal move binds the player")
+	}
+	mustMove(t, g, "H2", "B", 0)
+
+	mustMove(t, g, "P1", "L", 1)
+	g.Touched = "P2"
+	if err := g.ProcessMove(Move{CharacterName: "H2", Direction: "F"}, 0); !errors.Is(err, ErrTouchMove) {
+		t.Fatalf("moving another piece than the one touched: got %v, want %v", err, ErrTouchMove)
+	}
+	mustMove(t, g, "P2", "R", 0)
+	if g.Touched != "" {
+		t.Errorf("touched piece %q still set after the move", g.Touched)
+	}
+}
@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Transcript renders the game's move history as numbered text in the style of
+// chess notation, one line per pair of moves with Player 1's move first. If
+// Player 2 moved first, the first line opens with ... in place of Player 1's
+// move. A move is written as piece-direction with xNAME for each capture, a
+// swap as A<>B and a pass as --. Each comment on a move follows it in
+// braces. Moves trimmed from the history are left out, and the numbering
+// carries on from them.
+func (g *Game) Transcript(roomID string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Room %q]\n", roomID)
+	fmt.Fprintf(&b, "[Result %q]\n", g.Result())
+	if g.GameOverReason != "" {
+		fmt.Fprintf(&b, "[Reason %q]\n", g.GameOverReason)
+	}
+	if g.Trimmed > 0 {
+		fmt.Fprintf(&b, "[Trimmed \"%d\"]\n", g.Trimmed)
+	}
+	b.WriteString("\n")
+
+	for i, move := range g.Moves {
+		ply := g.Trimmed + i + g.FirstPlayer
+		if ply%2 == 0 || i == 0 {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "%d.", ply/2+1)
+		}
+		if i == 0 && ply%2 == 1 {
+			b.WriteString(" ...")
+		}
+		b.WriteString(" ")
+		b.WriteString(move.notation())
+		for _, comment := range move.Comments {
+			fmt.Fprintf(&b, " {%s}", comment.Text)
+		}
+	}
+	if len(g.Moves) > 0 {
+		b.WriteString(" ")
+	}
+	b.WriteString(g.Result())
+	b.WriteString("\n")
+	return b.String()
+}
+
+// notation writes a single move for the transcript
+func (m MoveRecord) notation() string {
+	if m.Pass {
+		return "--"
+	}
+	if m.Swap != "" {
+		return m.Character + "<>" + m.Swap
+	}
+	s := m.Character + "-" + m.Direction
+	for _, name := range m.Captured {
+		s += "x" + name
+	}
+	return s
+}
+
+// Result is the game's outcome as 1-0, 0-1 or 1/2-1/2, or * while it is still
+// being played or if it was aborted
+func (g *Game) Result() string {
+	switch {
+	case !g.GameOver, g.GameOverReason == ReasonAborted:
+		return "*"
+	case g.Winner == 0:
+		return "1-0"
+	case g.Winner == 1:
+		return "0-1"
+	default:
+		return "1/2-1/2"
+	}
+}
@@ -0,0 +1,32 @@
+package engine
+
+import "testing"
+
+func TestTranscript(t *testing.T) {
+	g := newTestGame(testRules())
+	mustMove(t, g, "P1", "B", 0)
+	mustMove(t, g, "P1", "F", 1)
+	mustMove(t, g, "P1", "B", 0)
+	mustMove(t, g, "P1", "F", 1)
+	want := "[Room \"r\"]\n[Result \"*\"]\n\n1. P1-B P1-F\n2. P1-B P1-FxP1 *\n"
+	if got := g.Transcript("r"); got != want {
+		t.Errorf("got transcript\n%s\nwant\n%s", got, want)
+	}
+
+	g.EndGame(1, ReasonResignation)
+	want = "[Room \"r\"]\n[Result \"0-1\"]\n[Reason \"resignation\"]\n\n1. P1-B P1-F\n2. P1-B P1-FxP1 0-1\n"
+	if got := g.Transcript("r"); got != want {
+		t.Errorf("got transcript\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTranscriptSecondPlayerFirst(t *testing.T) {
+	g := newTestGame(testRules())
+	g.FirstPlayer, g.CurrentPlayer = 1, 1
+	mustMove(t, g, "P1", "F", 1)
+	mustMove(t, g, "P1", "B", 0)
+	want := "[Room \"r\"]\n[Result \"*\"]\n\n1. ... P1-F\n2. P1-B *\n"
+	if got := g.Transcript("r"); got != want {
+		t.Errorf("got transcript\n%s\nwant\n%s", got, want)
+	}
+}
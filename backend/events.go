@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Event is an entry in a room's event log. Player is spectator for events not
+// tied to a player.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Player int       `json:"player"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// eventLog is a ring buffer keeping a room's most recent events
+type eventLog struct {
+	events []Event
+	// start is the index of the oldest event once the buffer is full
+	start int
+}
+
+func (l *eventLog) add(event Event, size int) {
+	if size <= 0 {
+		return
+	}
+	if len(l.events) < size {
+		l.events = append(l.events, event)
+		return
+	}
+	l.events[l.start] = event
+	l.start = (l.start + 1) % len(l.events)
+}
+
+// list returns the events from oldest to newest
+func (l *eventLog) list() []Event {
+	events := make([]Event, 0, len(l.events))
+	events = append(events, l.events[l.start:]...)
+	return append(events, l.events[:l.start]...)
+}
+
+// logEvent records an event in the room's log. Must be called with room.mu
+// held.
+func (room *Room) logEvent(eventType string, playerID int, detail string) {
+	room.events.add(Event{
+		Time:   time.Now(),
+		Type:   eventType,
+		Player: playerID,
+		Detail: detail,
+	}, config.EventLogSize)
+}
+
+// logMove records an applied move and, if the move ended the game, the end
+// of the game. Must be called with room.mu held.
+func (room *Room) logMove(playerID int, detail string) {
+	room.logEvent("move", playerID, detail)
+	if room.game.GameOver {
+		room.logEvent("game_over", room.game.Winner, room.game.GameOverReason)
+	}
+}
+
+// handleRoomEvents serves a room's event log as JSON. If the history is
+// hidden from spectators, the moves are left out until the game is over.
+func handleRoomEvents(w http.ResponseWriter, r *http.Request) {
+	room := findRoom(r.PathValue("id"))
+	if room == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	room.mu.Lock()
+	events := room.events.list()
+	if config.HideHistory && !room.game.GameOver {
+		events = slices.DeleteFunc(events, func(event Event) bool { return event.Type == "move" || event.Type == "annotate" })
+	}
+	room.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestEventLogKeepsNewest(t *testing.T) {
+	var buf eventLog
+	for _, detail := range []string{"a", "b", "c", "d"} {
+		buf.add(Event{Type: "test", Detail: detail}, 3)
+	}
+	var got []string
+	for _, event := range buf.list() {
+		got = append(got, event.Detail)
+	}
+	if want := []string{"b", "c", "d"}; !slices.Equal(got, want) {
+		t.Fatalf("log holds %v, want %v", got, want)
+	}
+}
+
+func TestRoomEvents(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, _ := startGame(t, srv, "room=a")
+	p0.move("P1", "B")
+	p0.expectState(0)
+
+	var events []Event
+	getJSON(t, srv.URL+"/rooms/a/events", &events)
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Type)
+	}
+	if want := []string{"join", "join", "ready", "ready", "start", "move"}; !slices.Equal(got, want) {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+	if last := events[len(events)-1]; last.Player != 0 || last.Detail != "P1 B" {
+		t.Errorf("move logged as %+v", last)
+	}
+
+	resp, err := http.Get(srv.URL + "/rooms/nowhere/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("events of a missing room: %s", resp.Status)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readDeadline returns the deadline for a connection's next read: readTimeout
+// from now, or HeartbeatTimeout after its last heartbeat, whichever comes
+// first. The zero time means no deadline.
+func readDeadline(readTimeout Duration, lastHeartbeat time.Time) time.Time {
+	var deadline time.Time
+	if config.HeartbeatTimeout > 0 {
+		deadline = lastHeartbeat.Add(time.Duration(config.HeartbeatTimeout))
+	}
+	if readTimeout > 0 {
+		if idle := time.Now().Add(time.Duration(readTimeout)); deadline.IsZero() || idle.Before(deadline) {
+			deadline = idle
+		}
+	}
+	return deadline
+}
+
+// missedHeartbeat reports whether a connection has gone longer than
+// HeartbeatTimeout without a heartbeat. A connection that has is closed
+// with a reason, rather than just dropped, so its client knows why.
+func missedHeartbeat(ws *websocket.Conn, lastHeartbeat time.Time) bool {
+	if config.HeartbeatTimeout <= 0 || time.Since(lastHeartbeat) < time.Duration(config.HeartbeatTimeout) {
+		return false
+	}
+	log.Printf("No heartbeat from %s since %s, disconnecting", ws.RemoteAddr(), lastHeartbeat.Format(time.RFC3339))
+	closeConn(ws, CloseNoHeartbeat, "no heartbeat")
+	return true
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMissedHeartbeatCloses(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.HeartbeatTimeout = Duration(150 * time.Millisecond) })
+	p0, _ := startGame(t, srv, "room=a")
+	watcher := dial(t, srv, "room=a")
+	watcher.expect("state", nil)
+
+	for i := 0; i < 8; i++ {
+		p0.send(Message{Action: "heartbeat"})
+		time.Sleep(50 * time.Millisecond)
+	}
+	watcher.expectClose(CloseNoHeartbeat)
+	p0.move("P1", "B")
+	p0.expectState(1)
+}
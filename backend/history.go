@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+
+	"hitwicket/engine"
+)
+
+// trimHistory keeps the current game's history within MaxHistory moves,
+// saving the oldest to the store before dropping them from memory. If they
+// can't be saved they are kept, to try again after the next move. Must be
+// called with room.mu held.
+func (room *Room) trimHistory() {
+	game := room.game
+	n := len(game.Moves) - config.MaxHistory
+	if config.MaxHistory == 0 || n <= 0 {
+		return
+	}
+	if room.gameID == "" {
+		id, err := randomID()
+		if err != nil {
+			log.Printf("error: %v", err)
+			return
+		}
+		room.gameID = id
+	}
+	if err := store.AppendMoves(room.gameID, game.Moves[:n]); err != nil {
+		log.Printf("error: %v", err)
+		return
+	}
+	game.TrimHistory(n)
+}
+
+// fullHistory returns every move of the current game, those saved to the
+// store by trimHistory followed by those still in memory, collecting the
+// saved ones from the store. Must be called with room.mu held.
+func (room *Room) fullHistory() []engine.MoveRecord {
+	var moves []engine.MoveRecord
+	if room.gameID != "" {
+		saved, err := store.TakeMoves(room.gameID)
+		if err != nil {
+			log.Printf("error: %v", err)
+		}
+		moves = saved
+	}
+	return append(moves, room.game.Moves...)
+}
+
+// discardSavedMoves drops whatever moves trimHistory saved for the current
+// game that are still in the store, so that none are left there once the
+// room moves on from the game. Must be called with room.mu held.
+func (room *Room) discardSavedMoves() {
+	if room.gameID == "" {
+		return
+	}
+	if _, err := store.TakeMoves(room.gameID); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHistoryCap(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.MaxHistory = 2 })
+	p0, p1 := startGame(t, srv, "room=a")
+	moves := []string{"P5 B", "P1 F", "P5 B", "P1 F", "P3 B", "P3 F", "P5 L", "P1 R"}
+	for i, move := range moves {
+		player, other := p0, p1
+		if i%2 == 1 {
+			player, other = p1, p0
+		}
+		name, direction, _ := strings.Cut(move, " ")
+		player.move(name, direction)
+		if state := other.expectState(i + 1); state.Version != i+1 {
+			t.Fatalf("move %d: got version %d", i+1, state.Version)
+		}
+	}
+
+	room := findRoom("a")
+	room.mu.Lock()
+	kept, trimmed := len(room.game.Moves), room.game.Trimmed
+	room.mu.Unlock()
+	if kept != 2 || trimmed != len(moves)-2 {
+		t.Fatalf("kept %d moves in memory and trimmed %d, want 2 kept and the rest trimmed", kept, trimmed)
+	}
+
+	// The finished game is stored with every move, in order
+	p0.send(Message{Action: "resign"})
+	p0.expectGameOver()
+	records, err := store.ListGames()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("stored games %+v, %v, want one", records, err)
+	}
+	var stored []string
+	for _, move := range records[0].Moves {
+		stored = append(stored, move.Character+" "+move.Direction)
+	}
+	if !slices.Equal(stored, moves) {
+		t.Fatalf("stored moves %v, want %v", stored, moves)
+	}
+}
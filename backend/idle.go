@@ -0,0 +1,143 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"hitwicket/engine"
+)
+
+// startIdleClock charges the player whose turn just ended for the time they
+// took and starts timing the player now to move, who forfeits once their
+// total for the game passes the idle limit. The first move of a game may
+// also use up the first move bonus before being charged. The AI's turns
+// aren't timed, and nor is anyone's while the game is paused.
+// Must be called with room.mu held.
+func (room *Room) startIdleClock() {
+	if room.options.IdleLimit <= 0 {
+		return
+	}
+	now := time.Now()
+	if !room.turnStart.IsZero() {
+		taken := now.Sub(room.turnStart)
+		bonus := min(taken, room.turnBonus)
+		room.bonusUsed += bonus
+		room.idle[room.turnPlayer] += taken - bonus
+		room.turnStart = time.Time{}
+	}
+	room.stopIdleClock()
+
+	game := room.game
+	playerID := game.CurrentPlayer
+	if !game.Started || game.GameOver || game.Paused || (config.AI && playerID == aiPlayer) {
+		return
+	}
+	room.turnPlayer = playerID
+	room.turnStart = now
+	room.turnBonus = 0
+	if game.MoveCount() == 0 {
+		room.turnBonus = max(time.Duration(room.options.FirstMoveBonus)-room.bonusUsed, 0)
+	}
+	remaining := time.Duration(room.options.IdleLimit) - room.idle[playerID] + room.turnBonus
+	room.idleTimer = time.AfterFunc(remaining, func() {
+		room.forfeitIdle(game, playerID)
+	})
+	room.scheduleClockTick()
+}
+
+// stopIdleClock cancels the pending idle forfeit, if any. Must be called with
+// room.mu held.
+func (room *Room) stopIdleClock() {
+	if room.idleTimer != nil {
+		room.idleTimer.Stop()
+		room.idleTimer = nil
+	}
+	if room.clockTimer != nil {
+		room.clockTimer.Stop()
+		room.clockTimer = nil
+	}
+}
+
+// serverStart is the origin of the server clock sent in clock messages. Go
+// measures durations from it on the monotonic clock, so the server clock
+// doesn't jump when the wall clock is adjusted.
+var serverStart = time.Now()
+
+// serverMS is a time on the server clock, in milliseconds
+func serverMS(t time.Time) int64 {
+	return t.Sub(serverStart).Milliseconds()
+}
+
+// ClockMessage tells clients how much idle time each player has left, so
+// they can keep their clocks in step between moves
+type ClockMessage struct {
+	Type string `json:"type"`
+	// Running is the player whose clock is counting down
+	Running     int      `json:"running"`
+	RemainingMS [2]int64 `json:"remaining_ms"`
+	// ServerMS is when the message was sent and TurnStartMS when the running
+	// player's turn began, both on the server clock. A client can estimate
+	// its offset from the server clock with ServerMS and count the running
+	// player's time down from TurnStartMS, when they had
+	// RemainingMS[Running] + ServerMS - TurnStartMS left. On the first move
+	// of a game, the running player's time includes the first move bonus.
+	ServerMS    int64 `json:"server_ms"`
+	TurnStartMS int64 `json:"turn_start_ms,omitempty"`
+}
+
+// scheduleClockTick sends clients the clocks after the tick interval, and
+// again every interval until the clock is stopped. Must be called with
+// room.mu held.
+func (room *Room) scheduleClockTick() {
+	if config.ClockTick <= 0 {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Duration(config.ClockTick), func() {
+		room.mu.Lock()
+		defer room.mu.Unlock()
+		if room.clockTimer != timer {
+			return
+		}
+		room.broadcastClock()
+		room.scheduleClockTick()
+	})
+	room.clockTimer = timer
+}
+
+// broadcastClock sends every client the time left on each player's clock.
+// Must be called with room.mu held.
+func (room *Room) broadcastClock() {
+	now := time.Now()
+	msg := ClockMessage{Type: "clock", Running: room.turnPlayer, ServerMS: serverMS(now)}
+	if !room.turnStart.IsZero() {
+		msg.TurnStartMS = serverMS(room.turnStart)
+	}
+	for playerID := range msg.RemainingMS {
+		remaining := time.Duration(room.options.IdleLimit) - room.idle[playerID]
+		if playerID == room.turnPlayer && !room.turnStart.IsZero() {
+			// Counted on the server clock, so that clients working from
+			// the timestamps arrive at the same time left
+			remaining += room.turnBonus - time.Duration(msg.ServerMS-msg.TurnStartMS)*time.Millisecond
+		}
+		msg.RemainingMS[playerID] = max(remaining, 0).Milliseconds()
+	}
+	for client := range room.clients {
+		if err := writeMessage(client, msg); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+}
+
+// forfeitIdle ends a game against a player who has used up their idle time,
+// unless they moved or the game ended in the meantime.
+func (room *Room) forfeitIdle(game *engine.Game, playerID int) {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.game != game || game.GameOver || game.CurrentPlayer != playerID {
+		return
+	}
+	log.Printf("Player %d forfeits after using up their idle time", playerID)
+	room.idleTimer = nil
+	room.endGame((playerID+1)%2, engine.ReasonTimeout)
+}
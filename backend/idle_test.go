@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"hitwicket/engine"
+)
+
+func TestIdleTimeAddsUpAcrossTurns(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.IdleLimit = Duration(300 * time.Millisecond) })
+	p0, p1 := startGame(t, srv, "room=a")
+
+	// Each of player 0's turns is within the limit, but not both together
+	time.Sleep(200 * time.Millisecond)
+	p0.move("P1", "B")
+	if state := p1.expectState(0); state.GameOver {
+		t.Fatalf("game ended after the first turn: %q", state.GameOverReason)
+	}
+	p1.move("P1", "F")
+	state := p0.expectState(0)
+	for !state.GameOver {
+		state = p0.expectState(0)
+	}
+	if state.Winner != 1 || state.GameOverReason != engine.ReasonTimeout {
+		t.Fatalf("game ended with winner %d by %q, want a timeout win for player 1", state.Winner, state.GameOverReason)
+	}
+}
+
+func TestClockBroadcast(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) {
+		c.IdleLimit = Duration(10 * time.Second)
+		c.ClockTick = Duration(50 * time.Millisecond)
+	})
+	_, p1 := startGame(t, srv, "room=a")
+	var first, second ClockMessage
+	p1.expect("clock", &first)
+	p1.expect("clock", &second)
+	if first.Running != 0 || first.RemainingMS[1] != 10000 || first.RemainingMS[0] >= 10000 {
+		t.Fatalf("got clock %+v, want player 0's running down and player 1's full", first)
+	}
+	if second.RemainingMS[0] >= first.RemainingMS[0] {
+		t.Fatalf("player 0's clock went from %dms to %dms, want it running down", first.RemainingMS[0], second.RemainingMS[0])
+	}
+}
+
+func TestClockTimestamps(t *testing.T) {
+	limit := 10 * time.Second
+	srv := newTestServer(t, func(c *Config) {
+		c.IdleLimit = Duration(limit)
+		c.ClockTick = Duration(50 * time.Millisecond)
+	})
+	p0, p1 := startGame(t, srv, "room=a")
+
+	// The running player had their whole limit when their turn began, and
+	// the time left counted down from then on the server clock comes to the
+	// time left the message gives
+	var clock ClockMessage
+	p1.expect("clock", &clock)
+	if clock.TurnStartMS == 0 || clock.ServerMS < clock.TurnStartMS {
+		t.Fatalf("got clock %+v, want the turn to start before the message was sent", clock)
+	}
+	if at := clock.RemainingMS[0] + clock.ServerMS - clock.TurnStartMS; at != limit.Milliseconds() {
+		t.Fatalf("player 0 had %dms at the start of their turn, want %dms", at, limit.Milliseconds())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	p0.move("P1", "B")
+	p1.expectState(1)
+	for clock.Running != 1 {
+		p1.expect("clock", &clock)
+	}
+	if at := clock.RemainingMS[1] + clock.ServerMS - clock.TurnStartMS; at != limit.Milliseconds() {
+		t.Fatalf("player 1 had %dms at the start of their turn, want %dms", at, limit.Milliseconds())
+	}
+	room := findRoom("a")
+	room.mu.Lock()
+	used := room.idle[0]
+	room.mu.Unlock()
+	// The clock is in whole milliseconds, so it can round up what was used
+	if got := limit.Milliseconds() - clock.RemainingMS[0]; got < used.Milliseconds() || got > used.Milliseconds()+1 {
+		t.Fatalf("clock has player 0 using %dms, the server %s", got, used)
+	}
+}
+
+func TestFirstMoveBonus(t *testing.T) {
+	limit, bonus := 200*time.Millisecond, 300*time.Millisecond
+	srv := newTestServer(t, func(c *Config) {
+		c.IdleLimit = Duration(limit)
+		c.FirstMoveBonus = Duration(bonus)
+	})
+	p0, p1 := startGame(t, srv, "room=a")
+
+	// The first move takes longer than the idle limit, but not than the
+	// limit and the bonus together, and only what goes past the bonus counts
+	time.Sleep(bonus + limit/2)
+	p0.move("P1", "B")
+	if state := p1.expectState(1); state.GameOver {
+		t.Fatalf("game ended during the first move: %q", state.GameOverReason)
+	}
+	room := findRoom("a")
+	room.mu.Lock()
+	used := room.idle[0]
+	room.mu.Unlock()
+	if used < limit/2 || used >= limit {
+		t.Fatalf("player 0 was charged %s for the first move, want about %s", used, limit/2)
+	}
+
+	// Player 1's first move isn't the game's, so they get no bonus
+	if state := p0.expectGameOver(); state.Winner != 0 || state.GameOverReason != engine.ReasonTimeout {
+		t.Fatalf("game ended with winner %d by %q, want a timeout win for player 0", state.Winner, state.GameOverReason)
+	}
+}
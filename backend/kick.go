@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// watcher is who a spectator is: the ID the server gave them on joining, the
+// user ID they connected with, if any, and the address they connected from
+type watcher struct {
+	id     string
+	userID string
+	addr   string
+}
+
+// name is how a spectator is known in the room: by their user ID if they
+// have one and otherwise by the ID they were given, which the join event
+// tells the players so that spectators without a user ID can be kicked too
+func (w watcher) name() string {
+	if w.userID != "" {
+		return w.userID
+	}
+	return w.id
+}
+
+// addWatcher records a spectator joining the room. Must be called with
+// room.mu held.
+func (room *Room) addWatcher(ws *websocket.Conn, userID, addr string) watcher {
+	room.nextWatcher++
+	w := watcher{id: fmt.Sprintf("spectator-%d", room.nextWatcher), userID: userID, addr: addr}
+	if room.watchers == nil {
+		room.watchers = make(map[*websocket.Conn]watcher)
+	}
+	room.watchers[ws] = w
+	return w
+}
+
+// kickSpectator disconnects every spectator known in the room as name, by, a
+// player's ID or spectator for an admin, and for KickCooldown keeps out both
+// the user IDs and the addresses they connected with, so that they can't come
+// straight back under another user ID or none. It reports whether there was
+// anyone to kick. Must be called with room.mu held.
+func (room *Room) kickSpectator(name string, by int) bool {
+	if name == "" {
+		return false
+	}
+	until := time.Now().Add(time.Duration(config.KickCooldown))
+	found := false
+	for ws, w := range room.watchers {
+		if w.id != name && w.userID != name {
+			continue
+		}
+		closeConn(ws, CloseKicked, "kicked")
+		ws.Close()
+		found = true
+		if config.KickCooldown <= 0 {
+			continue
+		}
+		if w.userID != "" {
+			if room.kickedUsers == nil {
+				room.kickedUsers = make(map[string]time.Time)
+			}
+			room.kickedUsers[w.userID] = until
+		}
+		if room.kickedAddrs == nil {
+			room.kickedAddrs = make(map[string]time.Time)
+		}
+		room.kickedAddrs[w.addr] = until
+	}
+	if !found {
+		return false
+	}
+	log.Printf("Kicked spectator %s from room %s", name, room.ID)
+	room.logEvent("kick", by, name)
+	return true
+}
+
+// isKicked reports whether a user, or anyone at an address, was kicked from
+// the room too recently to watch it again. Must be called with room.mu held.
+func (room *Room) isKicked(userID, addr string) bool {
+	return userID != "" && kickedUntil(room.kickedUsers, userID) || kickedUntil(room.kickedAddrs, addr)
+}
+
+// kickedUntil reports whether key's cooldown in kicked is still running,
+// forgetting it once it is over
+func kickedUntil(kicked map[string]time.Time, key string) bool {
+	until, ok := kicked[key]
+	if !ok {
+		return false
+	}
+	if time.Now().Before(until) {
+		return true
+	}
+	delete(kicked, key)
+	return false
+}
+
+// handleKickSpectator kicks a spectator from a room by their user ID, or the
+// ID they were given on joining. It needs the admin token, like the other
+// admin endpoints.
+func handleKickSpectator(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+	room := findRoom(r.PathValue("id"))
+	if room == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	room.mu.Lock()
+	kicked := room.kickSpectator(r.PathValue("user"), spectator)
+	room.mu.Unlock()
+	if !kicked {
+		http.Error(w, "no such spectator", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
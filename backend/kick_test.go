@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestKickSpectator(t *testing.T) {
+	cooldown := 300 * time.Millisecond
+	srv := newTestServer(t, func(c *Config) { c.KickCooldown = Duration(cooldown) })
+	_, guest := startGameWith(t, srv, "room=a&user=alice", "room=a&user=bob")
+	eve := dial(t, srv, "room=a&user=eve")
+	eve.expect("state", nil)
+
+	// Either player may kick, not only the one who sat down first
+	guest.send(Message{Action: "kick", User: "mallory"})
+	guest.expectError()
+	guest.send(Message{Action: "kick", User: "eve"})
+	eve.expectClose(CloseKicked)
+
+	// Eve can't watch again during the cooldown, under her user ID or
+	// another
+	dial(t, srv, "room=a&user=eve").expectClose(CloseBanned)
+	dial(t, srv, "room=a&user=mallory").expectClose(CloseBanned)
+	dial(t, srv, "room=b&user=eve").expect("state", nil)
+
+	// The ban is only on watching, so a player can take their seat back
+	// from the same address
+	guest.ws.Close()
+	waitFor(t, func() bool { return !connected("a")[1] })
+	dial(t, srv, "room=a&user=bob").expect("state", nil)
+	waitFor(t, func() bool { return connected("a")[1] })
+
+	time.Sleep(cooldown)
+	dial(t, srv, "room=a&user=eve").expect("state", nil)
+}
+
+func TestKickAnonymousSpectator(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.AdminToken = "secret" })
+	startGame(t, srv, "room=a")
+	watcher := dial(t, srv, "room=a")
+	watcher.expect("state", nil)
+
+	// The players learn the ID an anonymous spectator was given from the
+	// join event
+	var events []Event
+	getJSON(t, srv.URL+"/rooms/a/events", &events)
+	var id string
+	for _, event := range events {
+		if event.Type == "join" && event.Player == spectator {
+			id = event.Detail
+		}
+	}
+	if id == "" {
+		t.Fatalf("no spectator join in events %+v", events)
+	}
+
+	if status := adminRequest(t, srv, http.MethodDelete, "/rooms/a/spectators/"+id, ""); status != http.StatusUnauthorized {
+		t.Fatalf("kick without the admin token got %d", status)
+	}
+	if status := adminRequest(t, srv, http.MethodDelete, "/rooms/a/spectators/"+id, "secret"); status != http.StatusNoContent {
+		t.Fatalf("kick got %d", status)
+	}
+	watcher.expectClose(CloseKicked)
+	if status := adminRequest(t, srv, http.MethodDelete, "/rooms/a/spectators/"+id, "secret"); status != http.StatusNotFound {
+		t.Fatalf("second kick of the same spectator got %d", status)
+	}
+	dial(t, srv, "room=a").expectClose(CloseBanned)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Standing is a user's record across every game they have finished
+type Standing struct {
+	UserID string `json:"user_id"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Draws  int    `json:"draws"`
+}
+
+// recordResult keeps a finished game in the store and adds it to the
+// standings of its players. Must be called with room.mu held.
+func (room *Room) recordResult() {
+	game := room.game
+	id := room.gameID
+	if id == "" {
+		var err error
+		if id, err = randomID(); err != nil {
+			log.Printf("error: %v", err)
+			return
+		}
+	}
+	record := GameRecord{
+		ID:          id,
+		Room:        room.ID,
+		FirstPlayer: game.FirstPlayer,
+		Winner:      game.Winner,
+		Reason:      game.GameOverReason,
+		Result:      game.Result(),
+		Start:       game.Start,
+		Moves:       room.fullHistory(),
+		Captures:    game.Captures(),
+		Options:     room.options,
+		Finished:    time.Now(),
+	}
+	for i, player := range game.Players {
+		record.Players[i] = player.Name
+		record.UserIDs[i] = player.UserID
+	}
+	room.record = &record
+	if err := store.SaveGame(record); err != nil {
+		log.Printf("error: %v", err)
+	}
+	if err := store.UpdateStats(record); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+// sortStandings returns the standings with the most wins first, then the
+// fewest losses
+func sortStandings(standings map[string]*Standing) []Standing {
+	board := make([]Standing, 0, len(standings))
+	for _, standing := range standings {
+		board = append(board, *standing)
+	}
+	sort.Slice(board, func(i, j int) bool {
+		if board[i].Wins != board[j].Wins {
+			return board[i].Wins > board[j].Wins
+		}
+		if board[i].Losses != board[j].Losses {
+			return board[i].Losses < board[j].Losses
+		}
+		return board[i].UserID < board[j].UserID
+	})
+	return board
+}
+
+// handleLeaderboard serves every user's standing as JSON, best first
+func handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	board, err := store.Stats()
+	if err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, "could not read the leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(board); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLeaderboard(t *testing.T) {
+	srv := newTestServer(t, nil)
+	alice, _ := startGameWith(t, srv, "room=a&user=alice", "room=a&user=bob")
+	alice.send(Message{Action: "resign"})
+	for !alice.expectState(0).GameOver {
+	}
+
+	var board []Standing
+	getJSON(t, srv.URL+"/leaderboard", &board)
+	want := []Standing{{UserID: "bob", Wins: 1}, {UserID: "alice", Losses: 1}}
+	if !slices.Equal(board, want) {
+		t.Fatalf("got leaderboard %+v, want %+v", board, want)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBackoffDoublings is how many times a user's reconnect backoff doubles
+// before it stops growing
+const maxBackoffDoublings = 6
+
+var (
+	// connsPerIP counts each client address's open connections
+	connsPerIP   = make(map[string]int)
+	connsPerIPMu sync.Mutex
+
+	// roomsPerIP counts the open rooms each client address has created
+	roomsPerIP   = make(map[string]int)
+	roomsPerIPMu sync.Mutex
+
+	// attempts holds each user's recent run of connection attempts
+	attempts   = make(map[string]*attemptRun)
+	attemptsMu sync.Mutex
+)
+
+// attemptRun is a run of connections by one user, each made within the
+// longest backoff of the one before
+type attemptRun struct {
+	count int
+	last  time.Time
+}
+
+// clientIP returns the address a request came from, taken from the first
+// X-Forwarded-For entry when the server is configured to trust it
+func clientIP(r *http.Request) string {
+	if config.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// acquireConn counts a new connection from ip, reporting false without
+// counting it if ip already has as many connections as allowed
+func acquireConn(ip string) bool {
+	if config.MaxConnsPerIP <= 0 {
+		return true
+	}
+	connsPerIPMu.Lock()
+	defer connsPerIPMu.Unlock()
+	if connsPerIP[ip] >= config.MaxConnsPerIP {
+		return false
+	}
+	connsPerIP[ip]++
+	return true
+}
+
+// releaseConn stops counting a closed connection from ip
+func releaseConn(ip string) {
+	if config.MaxConnsPerIP <= 0 {
+		return
+	}
+	connsPerIPMu.Lock()
+	defer connsPerIPMu.Unlock()
+	connsPerIP[ip]--
+	if connsPerIP[ip] <= 0 {
+		delete(connsPerIP, ip)
+	}
+}
+
+// acquireRoom counts a new room created by ip, reporting false without
+// counting it if ip already has as many open rooms as allowed
+func acquireRoom(ip string) bool {
+	if config.MaxRoomsPerIP <= 0 {
+		return true
+	}
+	roomsPerIPMu.Lock()
+	defer roomsPerIPMu.Unlock()
+	if roomsPerIP[ip] >= config.MaxRoomsPerIP {
+		return false
+	}
+	roomsPerIP[ip]++
+	return true
+}
+
+// releaseRoom stops counting a closed room created by ip
+func releaseRoom(ip string) {
+	if config.MaxRoomsPerIP <= 0 {
+		return
+	}
+	roomsPerIPMu.Lock()
+	defer roomsPerIPMu.Unlock()
+	roomsPerIP[ip]--
+	if roomsPerIP[ip] <= 0 {
+		delete(roomsPerIP, ip)
+	}
+}
+
+// allowAttempt records a connection by userID, reporting false if it came
+// sooner after the last one allowed than the backoff permits. The backoff
+// starts at ReconnectBackoff and doubles with every connection in the run. A
+// user who stays away for as long as the longest backoff starts afresh.
+// Connections without a user ID aren't throttled.
+func allowAttempt(userID string) bool {
+	if config.ReconnectBackoff <= 0 || userID == "" {
+		return true
+	}
+	longest := time.Duration(config.ReconnectBackoff) << maxBackoffDoublings
+	attemptsMu.Lock()
+	defer attemptsMu.Unlock()
+	now := time.Now()
+	run, ok := attempts[userID]
+	if !ok || now.Sub(run.last) >= longest {
+		run = &attemptRun{}
+		attempts[userID] = run
+	} else if backoff := time.Duration(config.ReconnectBackoff) << min(run.count-1, maxBackoffDoublings); now.Sub(run.last) < backoff {
+		return false
+	}
+	run.count++
+	run.last = now
+
+	time.AfterFunc(longest, func() {
+		attemptsMu.Lock()
+		defer attemptsMu.Unlock()
+		if attempts[userID] == run && time.Since(run.last) >= longest {
+			delete(attempts, userID)
+		}
+	})
+	return true
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnectionLimitPerIP(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.MaxConnsPerIP = 2 })
+	p0 := dial(t, srv, "room=a")
+	p0.expectState(0)
+	dial(t, srv, "room=a").expectState(0)
+	dial(t, srv, "room=b").expectClose(CloseTooManyConns)
+
+	// Closing a connection frees its place
+	p0.ws.Close()
+	waitFor(t, func() bool {
+		connsPerIPMu.Lock()
+		defer connsPerIPMu.Unlock()
+		return connsPerIP["127.0.0.1"] == 1
+	})
+	dial(t, srv, "room=b").expectState(0)
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	backoff := 100 * time.Millisecond
+	srv := newTestServer(t, func(c *Config) { c.ReconnectBackoff = Duration(backoff) })
+	first := dial(t, srv, "room=a&user=alice")
+	first.expect("state", nil)
+	first.ws.Close()
+	dial(t, srv, "room=a&user=alice").expectClose(CloseThrottled)
+	dial(t, srv, "room=a").expect("state", nil)
+
+	// The backoff doubles with every connection allowed in the run
+	time.Sleep(backoff)
+	if !allowAttempt("alice") {
+		t.Fatal("connection after the first backoff refused")
+	}
+	time.Sleep(backoff)
+	if allowAttempt("alice") {
+		t.Fatal("connection inside the doubled backoff allowed")
+	}
+	time.Sleep(backoff)
+	if !allowAttempt("alice") {
+		t.Fatal("connection after the doubled backoff refused")
+	}
+	if !allowAttempt("bob") {
+		t.Fatal("another user's connection refused")
+	}
+}
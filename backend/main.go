@@ -1,324 +1,330 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"github.com/gorilla/websocket"
+	"hitwicket/engine"
 )
 
-// Game represents the game state
-type Game struct {
-	Board         [5][5]*Character
-	Players       [2]*Player
-	CurrentPlayer int
-	GameOver      bool
-	Winner        int
+// Message represents an inbound client message. A message without an action
+// is a move.
+type Message struct {
+	Action string `json:"action"`
+	engine.Move
+
+	// A and B name the pieces exchanged by a swap
+	A string `json:"a,omitempty"`
+	B string `json:"b,omitempty"`
+
+	// Setup places a player's pieces before the game starts
+	Setup []engine.SetupPiece `json:"setup,omitempty"`
+
+	// MoveIndex and Text are the move an annotation is on, counting from 0,
+	// and what it says
+	MoveIndex int    `json:"move_index,omitempty"`
+	Text      string `json:"text,omitempty"`
+
+	// User is the user ID of the spectator to kick, or the ID they were
+	// given on joining
+	User string `json:"user,omitempty"`
+
+	// View is the player a spectator watches from the side of
+	View int `json:"view,omitempty"`
+
+	// Speed is how many times faster than normal a replay plays
+	Speed float64 `json:"speed,omitempty"`
+
+	// Name is the name a player wants to go by
+	Name string `json:"name,omitempty"`
+}
+
+// ErrorMessage tells a client why its request was rejected
+type ErrorMessage struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+	Code   string `json:"code,omitempty"`
+	// Result is the outcome of the game, for errors about a finished game
+	Result string `json:"result,omitempty"`
+}
+
+// AckMessage acknowledges a resent move that was already applied
+type AckMessage struct {
+	Type   string `json:"type"`
+	Nonce  string `json:"nonce"`
+	Status string `json:"status"`
+}
+
+// PieceInfo describes one of a player's pieces and the directions it can move in
+type PieceInfo struct {
+	Type  string   `json:"type"`
+	Name  string   `json:"name"`
+	X     int      `json:"x"`
+	Y     int      `json:"y"`
+	Moves []string `json:"moves"`
+}
+
+// PiecesMessage answers a my_pieces request
+type PiecesMessage struct {
+	Type   string      `json:"type"`
+	Pieces []PieceInfo `json:"pieces"`
 }
 
-// Player represents a player in the game
-type Player struct {
-	ID         int
-	Characters []*Character
+// MobilityMessage tells a player how many legal moves each player has
+type MobilityMessage struct {
+	Type  string `json:"type"`
+	Moves [2]int `json:"moves"`
 }
 
-// Character represents a game piece
-type Character struct {
-	Type  string
-	Name  string
-	X     int
-	Y     int
-	Owner int
+// CapturesMessage lists the pieces each player has captured
+type CapturesMessage struct {
+	Type     string                    `json:"type"`
+	Captures [2][]engine.CapturedPiece `json:"captures"`
 }
 
-// Move represents a move command
-type Move struct {
-	CharacterName string `json:"character_name"`
-	Direction     string `json:"direction"`
+// ThreatsMessage shows a player the cells the opponent could capture on with
+// their next move, indexed [y][x] like the board
+type ThreatsMessage struct {
+	Type    string   `json:"type"`
+	Threats [][]bool `json:"threats"`
+}
+
+// SelectionMessage shows watchers which piece the player to move has picked
+// up and where it can go. A cleared selection has no character.
+type SelectionMessage struct {
+	Type      string          `json:"type"`
+	Player    int             `json:"player"`
+	Character string          `json:"character,omitempty"`
+	From      *engine.Square  `json:"from,omitempty"`
+	Targets   []engine.Square `json:"targets,omitempty"`
 }
 
 // GameState represents the current state of the game
 type GameState struct {
-	Board         [5][5]*Character `json:"board"`
-	CurrentPlayer int              `json:"current_player"`
-	GameOver      bool             `json:"game_over"`
-	Winner        int              `json:"winner"`
+	Type          string                `json:"type"`
+	Board         [][]*engine.Character `json:"board"`
+	Players       [2]*engine.Player     `json:"players"`
+	CurrentPlayer int                   `json:"current_player"`
+	GameOver      bool                  `json:"game_over"`
+	Winner        int                   `json:"winner"`
+	Started       bool                  `json:"started"`
+	Paused        bool                  `json:"paused"`
+	FirstPlayer   int                   `json:"first_player"`
+	// Version counts the moves played so far. A reconnecting player passes
+	// it back as ?since= to be sent the moves they missed.
+	Version int `json:"version"`
+
+	GameOverReason string             `json:"game_over_reason,omitempty"`
+	Match          *Match             `json:"match,omitempty"`
+	LastMove       *engine.MoveRecord `json:"last_move,omitempty"`
+	// Submitted lists the players who have chosen their move for the round
+	// of a simultaneous game
+	Submitted []int `json:"submitted,omitempty"`
+	// DrawOffers lists the players with a draw offer standing
+	DrawOffers []int `json:"draw_offers,omitempty"`
+	// Transcript is only sent to spectators, once a game whose history was
+	// hidden from them is over
+	Transcript string `json:"transcript,omitempty"`
+	Checksum   string `json:"checksum"`
 }
 
 var (
 	upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		CheckOrigin:     func(r *http.Request) bool { return true },
+		CheckOrigin:     func(r *http.Request) bool { return checkOrigin(r.Header.Get("Origin")) },
+		Subprotocols:    subprotocols,
 	}
-	game    Game
-	clients = make(map[*websocket.Conn]int)
+
+	// subprotocols lists the protocol versions the server speaks, preferred
+	// first
+	subprotocols = []string{"hitwicket.v1", msgpackProtocol}
 )
 
+// spectator is the player ID clients is given for connections watching the
+// game rather than playing in it
+const spectator = -1
+
 func main() {
-	http.HandleFunc("/ws", handleConnections)
+	if err := parseConfig(os.Args[1:]); err != nil {
+		log.Fatal("config: ", err)
+	}
+	s, err := openStore(&config)
+	if err != nil {
+		log.Fatal("store: ", err)
+	}
+	store = s
 
-	initGame()
+	mux := http.NewServeMux()
+	routes(mux)
 
-	log.Println("Server starting on :8080")
-	err := http.ListenAndServe(":8080", nil)
-	if err != nil {
+	// Stopping the server disconnects every client with CloseShutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("Server starting on %s", config.Addr)
+	err = serve(ctx, &http.Server{Addr: config.Addr, Handler: mux})
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal("ListenAndServe: ", err)
 	}
 }
 
-func handleConnections(w http.ResponseWriter, r *http.Request) {
-	ws, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer ws.Close()
+// routes registers the server's handlers on mux
+func routes(mux *http.ServeMux) {
+	mux.HandleFunc("/ws", handleConnections)
+	mux.HandleFunc("GET /rooms/{id}/events", handleRoomEvents)
+	mux.HandleFunc("GET /rooms/{id}/transcript", handleRoomTranscript)
+	mux.HandleFunc("GET /leaderboard", handleLeaderboard)
+	mux.HandleFunc("GET /stats", handleStats)
+	mux.HandleFunc("GET /version", handleVersion)
+	mux.HandleFunc("POST /verify-game", handleVerifyGame)
+	mux.HandleFunc("GET /games/{id}/replay", handleReplay)
+	mux.HandleFunc("GET /readyz", handleReadyz)
+	mux.HandleFunc("POST /rooms", handleCreateRoom)
+	mux.HandleFunc("GET /rooms/{id}", handleRoomInfo)
+	mux.HandleFunc("DELETE /rooms/{id}/spectators/{user}", handleKickSpectator)
+	mux.HandleFunc("PUT /admin/drain", handleDrain)
+	mux.HandleFunc("DELETE /admin/drain", handleDrain)
+}
 
-	// Assign player to the game
-	playerID := len(clients)
-	if playerID >= 2 {
-		log.Println("Game is full")
+func handleConnections(w http.ResponseWriter, r *http.Request) {
+	if config.RequireProtocol && !offersSubprotocol(r) {
+		log.Printf("Rejected client offering subprotocols %v", websocket.Subprotocols(r))
+		http.Error(w, "unsupported protocol version", http.StatusBadRequest)
 		return
 	}
-	clients[ws] = playerID
-
-	// Send initial game state
-	sendGameState(ws)
-
-	for {
-		var move Move
-		err := ws.ReadJSON(&move)
-		if err != nil {
-			log.Printf("error: %v", err)
-			delete(clients, ws)
-			break
-		}
-
-		if game.CurrentPlayer == playerID && !game.GameOver {
-			processMove(move, playerID)
-			broadcastGameState()
-		}
+	if roomID := r.URL.Query().Get("room"); roomID != "" && !validRoomID(roomID) {
+		http.Error(w, "invalid room ID", http.StatusBadRequest)
+		return
 	}
-}
-
-func processMove(move Move, playerID int) {
-	character := findCharacter(move.CharacterName, playerID)
-	if character == nil {
-		log.Printf("Invalid character: %s", move.CharacterName)
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("error: %v", err)
 		return
 	}
+	defer ws.Close()
+	ws.SetReadLimit(config.MaxMessageSize)
 
-	if !isValidMove(character, move.Direction) {
-		log.Printf("Invalid move: %s %s", move.CharacterName, move.Direction)
+	ip := clientIP(r)
+	if !acquireConn(ip) {
+		log.Printf("Too many connections from %s", ip)
+		closeConn(ws, CloseTooManyConns, "too many connections from your address")
 		return
 	}
-
-	moveCharacter(character, move.Direction)
-	game.CurrentPlayer = (game.CurrentPlayer + 1) % 2
-
-	if checkGameOver() {
-		game.GameOver = true
-		game.Winner = playerID
+	defer releaseConn(ip)
+	if userID := r.URL.Query().Get("user"); !allowAttempt(userID) {
+		log.Printf("Throttled reconnect by %s", userID)
+		closeConn(ws, CloseThrottled, "too many attempts")
+		return
 	}
-}
 
-func findCharacter(name string, playerID int) *Character {
-	for _, char := range game.Players[playerID].Characters {
-		if char.Name == name {
-			return char
-		}
+	roomID := r.URL.Query().Get("room")
+	if roomID == "" {
+		roomID = defaultRoomID
 	}
-	return nil
-}
-
-func isValidMove(character *Character, direction string) bool {
-	newX, newY := calculateNewPosition(character, direction)
-
-	// Check if the move is within bounds
-	if newX < 0 || newX >= 5 || newY < 0 || newY >= 5 {
-		return false
+	if draining.Load() && findRoom(roomID) == nil {
+		log.Printf("Refused new room %s while draining", roomID)
+		closeConn(ws, CloseDraining, "server is draining, try another")
+		return
 	}
-
-	// Check if the move is valid for the character type
-	switch character.Type {
-	case "Pawn":
-		return isPawnMoveValid(direction)
-	case "Hero1":
-		return isHero1MoveValid(character, direction, newX, newY)
-	case "Hero2":
-		return isHero2MoveValid(direction)
+	room := lockRoom(roomID)
+
+	// Assign player to the game, or let them watch if there is no free slot
+	userID := r.URL.Query().Get("user")
+	if draining.Load() && !room.isReconnect(userID) && room.freePlayerSlot(userID) != spectator {
+		room.mu.Unlock()
+		log.Printf("Refused new player in room %s while draining", roomID)
+		closeConn(ws, CloseDraining, "server is draining, try another")
+		return
 	}
-
-	return false
-}
-
-func isPawnMoveValid(direction string) bool {
-	return direction == "L" || direction == "R" || direction == "F" || direction == "B"
-}
-
-func isHero1MoveValid(character *Character, direction string, newX, newY int) bool {
-	if direction != "L" && direction != "R" && direction != "F" && direction != "B" {
-		return false
+	playerID := spectator
+	if config.ReplaceConns && userID != "" {
+		playerID = room.replaceConnection(userID)
 	}
-
-	// Check if there's a friendly character in the path
-	midX, midY := (character.X+newX)/2, (character.Y+newY)/2
-	if game.Board[midY][midX] != nil && game.Board[midY][midX].Owner == character.Owner {
-		return false
+	if playerID == spectator {
+		playerID = room.freePlayerSlot(userID)
 	}
-
-	return true
-}
-
-func isHero2MoveValid(direction string) bool {
-	return direction == "FL" || direction == "FR" || direction == "BL" || direction == "BR"
-}
-
-func calculateNewPosition(character *Character, direction string) (int, int) {
-	x, y := character.X, character.Y
-
-	switch character.Type {
-	case "Pawn":
-		switch direction {
-		case "L":
-			x--
-		case "R":
-			x++
-		case "F":
-			y--
-		case "B":
-			y++
+	if playerID == spectator {
+		// A kick keeps its spectator out, not anyone taking a seat from the
+		// same address
+		if room.isKicked(userID, ip) {
+			room.mu.Unlock()
+			log.Printf("Refused kicked spectator %s in room %s", userID, roomID)
+			closeConn(ws, CloseBanned, "kicked from this room, try again later")
+			return
 		}
-	case "Hero1":
-		switch direction {
-		case "L":
-			x -= 2
-		case "R":
-			x += 2
-		case "F":
-			y -= 2
-		case "B":
-			y += 2
+		if config.MaxSpectators > 0 && room.spectators() >= config.MaxSpectators {
+			room.mu.Unlock()
+			log.Printf("Room %s is full of spectators", roomID)
+			closeConn(ws, CloseRoomFull, "too many spectators in this room")
+			return
 		}
-	case "Hero2":
-		switch direction {
-		case "FL":
-			x--
-			y -= 2
-		case "FR":
-			x++
-			y -= 2
-		case "BL":
-			x--
-			y += 2
-		case "BR":
-			x++
-			y += 2
+		room.clients[ws] = spectator
+		spec := room.addWatcher(ws, userID, ip)
+		if view, ok := room.userViews[userID]; ok {
+			room.setView(ws, view)
 		}
+		room.logEvent("join", spectator, spec.name())
+		log.Println("Spectator joined")
+		room.sendGameState(ws)
+		room.mu.Unlock()
+		room.watch(ws)
+		return
 	}
-
-	return x, y
-}
-
-func moveCharacter(character *Character, direction string) {
-	newX, newY := calculateNewPosition(character, direction)
-
-	// Remove character from old position
-	game.Board[character.Y][character.X] = nil
-
-	// Handle character elimination
-	if game.Board[newY][newX] != nil && game.Board[newY][newX].Owner != character.Owner {
-		eliminateCharacter(game.Board[newY][newX])
-	}
-
-	// Update character position
-	character.X, character.Y = newX, newY
-	game.Board[newY][newX] = character
-
-	// Handle Hero1 and Hero2 path elimination
-	if character.Type == "Hero1" || character.Type == "Hero2" {
-		midX, midY := (character.X+newX)/2, (character.Y+newY)/2
-		if game.Board[midY][midX] != nil && game.Board[midY][midX].Owner != character.Owner {
-			eliminateCharacter(game.Board[midY][midX])
-			game.Board[midY][midX] = nil
+	if config.DistinctPlayers && userID != "" {
+		for _, id := range room.clients {
+			if id != spectator && room.game.Players[id].UserID == userID {
+				room.mu.Unlock()
+				log.Printf("User %s tried to take both player slots", userID)
+				closeConn(ws, CloseAlreadyPlaying, "already playing in this game")
+				return
+			}
 		}
 	}
-}
-
-func eliminateCharacter(character *Character) {
-	player := game.Players[character.Owner]
-	for i, char := range player.Characters {
-		if char == character {
-			player.Characters = append(player.Characters[:i], player.Characters[i+1:]...)
-			break
-		}
+	room.addPlayer(ws, playerID, userID)
+	if since, err := strconv.Atoi(r.URL.Query().Get("since")); err == nil {
+		room.sendMissedMoves(ws, playerID, since)
 	}
+
+	// Send initial game state
+	room.sendGameState(ws)
+	room.mu.Unlock()
+
+	debug, _ := strconv.ParseBool(r.URL.Query().Get("debug"))
+	room.play(ws, playerID, debug)
 }
 
-func checkGameOver() bool {
-	for _, player := range game.Players {
-		if len(player.Characters) == 0 {
-			return true
+// offersSubprotocol reports whether a client asked for a protocol version the
+// server speaks
+func offersSubprotocol(r *http.Request) bool {
+	for _, offered := range websocket.Subprotocols(r) {
+		for _, supported := range subprotocols {
+			if offered == supported {
+				return true
+			}
 		}
 	}
 	return false
 }
 
-func broadcastGameState() {
-	for client := range clients {
-		sendGameState(client)
-	}
-}
-
-func sendGameState(client *websocket.Conn) {
-	state := GameState{
-		Board:         game.Board,
-		CurrentPlayer: game.CurrentPlayer,
-		GameOver:      game.GameOver,
-		Winner:        game.Winner,
-	}
-	err := client.WriteJSON(state)
+func sendError(client *websocket.Conn, reason string) {
+	err := writeMessage(client, ErrorMessage{Type: "error", Reason: reason})
 	if err != nil {
 		log.Printf("error: %v", err)
-		client.Close()
-		delete(clients, client)
 	}
 }
 
-func initGame() {
-	game = Game{
-		Board:         [5][5]*Character{},
-		Players:       [2]*Player{},
-		CurrentPlayer: 0,
-		GameOver:      false,
-	}
-
-	// Initialize players
-	for i := 0; i < 2; i++ {
-		game.Players[i] = &Player{
-			ID:         i,
-			Characters: make([]*Character, 0),
-		}
-	}
-
-	// Set up initial board state (example setup)
-	setupCharacters := []string{"Pawn", "Hero1", "Pawn", "Hero2", "Pawn"}
-	for i, charType := range setupCharacters {
-		for playerID := 0; playerID < 2; playerID++ {
-			y := 0
-			if playerID == 1 {
-				y = 4
-			}
-			char := &Character{
-				Type:  charType,
-				Name:  fmt.Sprintf("%s%d", charType[:1], i+1),
-				X:     i,
-				Y:     y,
-				Owner: playerID,
-			}
-			game.Players[playerID].Characters = append(game.Players[playerID].Characters, char)
-			game.Board[y][i] = char
-		}
+// sendErrorFor tells a client why its request was rejected, with the code of
+// the error it wraps
+func sendErrorFor(client *websocket.Conn, reason error) {
+	err := writeMessage(client, ErrorMessage{Type: "error", Reason: reason.Error(), Code: engine.ErrorCode(reason)})
+	if err != nil {
+		log.Printf("error: %v", err)
 	}
 }
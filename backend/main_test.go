@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+// newTestServer serves the server's routes with the default config, changed
+// by configure if given, and with no rooms, an empty memory store and fresh
+// connection limits. When the test ends, once its clients have gone, the
+// server waits for its handlers to finish and closes its rooms, so that
+// nothing of it is left to run against the next test's config and store.
+func newTestServer(t *testing.T, configure func(c *Config)) *httptest.Server {
+	t.Helper()
+	cfg := defaultConfig()
+	if configure != nil {
+		configure(&cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	savedConfig, savedStore := config, store
+	config, store = cfg, newMemoryStore()
+	resetServerState()
+
+	mux := http.NewServeMux()
+	routes(mux)
+	var handlers sync.WaitGroup
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.Add(1)
+		defer handlers.Done()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(func() {
+		srv.Close()
+		handlers.Wait()
+		closeRooms()
+		config, store = savedConfig, savedStore
+		resetServerState()
+	})
+	return srv
+}
+
+// closeRooms closes every open room, stopping the timers that would otherwise
+// abandon or forfeit its game later on
+func closeRooms() {
+	roomsMu.Lock()
+	var open []*Room
+	for _, room := range rooms {
+		open = append(open, room)
+	}
+	roomsMu.Unlock()
+	for _, room := range open {
+		room.mu.Lock()
+		if room.abandonTimer != nil {
+			room.abandonTimer.Stop()
+		}
+		for _, timer := range room.forfeitTimers {
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+		room.close()
+		room.mu.Unlock()
+	}
+}
+
+// resetServerState forgets every room, connection count, drain and cached
+// stats left over from an earlier test
+func resetServerState() {
+	roomsMu.Lock()
+	rooms = make(map[string]*Room)
+	roomsMu.Unlock()
+	connsPerIPMu.Lock()
+	connsPerIP = make(map[string]int)
+	connsPerIPMu.Unlock()
+	roomsPerIPMu.Lock()
+	roomsPerIP = make(map[string]int)
+	roomsPerIPMu.Unlock()
+	attemptsMu.Lock()
+	attempts = make(map[string]*attemptRun)
+	attemptsMu.Unlock()
+	draining.Store(false)
+	statsCache.mu.Lock()
+	statsCache.at = time.Time{}
+	statsCache.mu.Unlock()
+}
+
+// getJSON fetches url, failing the test unless it answers 200 OK, and decodes
+// the JSON body into v
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+}
+
+// wsURL is the address of one of srv's WebSocket endpoints
+func wsURL(srv *httptest.Server, path string) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + path
+}
+
+// testClient is a WebSocket connection to a test server
+type testClient struct {
+	t  *testing.T
+	ws *websocket.Conn
+}
+
+// dial connects to the game endpoint with the given query, failing the test
+// if it can't
+func dial(t *testing.T, srv *httptest.Server, query string) *testClient {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws?"+query), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return &testClient{t: t, ws: ws}
+}
+
+// send sends a message to the server
+func (c *testClient) send(msg Message) {
+	c.t.Helper()
+	if err := c.ws.WriteJSON(msg); err != nil {
+		c.t.Fatalf("send: %v", err)
+	}
+}
+
+// move sends a move of one of the player's pieces
+func (c *testClient) move(name, direction string) {
+	c.t.Helper()
+	c.send(Message{Move: engine.Move{CharacterName: name, Direction: direction}})
+}
+
+// next reads the next message, returning its type and the message itself
+func (c *testClient) next() (string, []byte) {
+	c.t.Helper()
+	c.ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := c.ws.ReadMessage()
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	var msg struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.t.Fatalf("decode %s: %v", data, err)
+	}
+	return msg.Type, data
+}
+
+// expect skips messages until one of type typ arrives and decodes it into v,
+// unless v is nil
+func (c *testClient) expect(typ string, v any) {
+	c.t.Helper()
+	for {
+		got, data := c.next()
+		if got != typ {
+			continue
+		}
+		if v != nil {
+			if err := json.Unmarshal(data, v); err != nil {
+				c.t.Fatalf("decode %s: %v", data, err)
+			}
+		}
+		return
+	}
+}
+
+// expectState skips messages until a state of at least version arrives
+func (c *testClient) expectState(version int) GameState {
+	c.t.Helper()
+	for {
+		var state GameState
+		c.expect("state", &state)
+		if state.Version >= version {
+			return state
+		}
+	}
+}
+
+// expectGameOver skips messages until a state of a finished game arrives
+func (c *testClient) expectGameOver() GameState {
+	c.t.Helper()
+	for {
+		if state := c.expectState(0); state.GameOver {
+			return state
+		}
+	}
+}
+
+// expectError skips messages until an error arrives and returns it
+func (c *testClient) expectError() ErrorMessage {
+	c.t.Helper()
+	var msg ErrorMessage
+	c.expect("error", &msg)
+	return msg
+}
+
+// expectClose reads until the server closes the connection, failing the test
+// unless it closes with code
+func (c *testClient) expectClose(code int) {
+	c.t.Helper()
+	c.ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := c.ws.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, code) {
+			c.t.Fatalf("got %v, want close code %d", err, code)
+		}
+		return
+	}
+}
+
+// waitFor polls cond until it holds, failing the test if it doesn't within
+// a few seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+	}
+}
+
+// inRoom reports whether cond holds for the game in a room, which must exist
+func inRoom(id string, cond func(g *engine.Game) bool) bool {
+	room := findRoom(id)
+	if room == nil {
+		return false
+	}
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	return cond(room.game)
+}
+
+// connected reports which players of a room are connected
+func connected(id string) [2]bool {
+	room := findRoom(id)
+	if room == nil {
+		return [2]bool{}
+	}
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	return room.connectedPlayers()
+}
+
+// waitForPlayer waits until it is playerID's turn in a room
+func waitForPlayer(t *testing.T, id string, playerID int) {
+	t.Helper()
+	waitFor(t, func() bool {
+		return inRoom(id, func(g *engine.Game) bool { return g.CurrentPlayer == playerID })
+	})
+}
+
+// startGame seats two players in a room and has both ready up, returning
+// them once each has been sent the started game
+func startGame(t *testing.T, srv *httptest.Server, query string) (*testClient, *testClient) {
+	t.Helper()
+	return startGameWith(t, srv, query, query)
+}
+
+// startGameWith is startGame for players connecting with different queries,
+// player 0 with query0
+func startGameWith(t *testing.T, srv *httptest.Server, query0, query1 string) (*testClient, *testClient) {
+	t.Helper()
+	p0 := dial(t, srv, query0)
+	p0.expectState(0)
+	p1 := dial(t, srv, query1)
+	p1.expectState(0)
+	p0.send(Message{Action: "ready"})
+	p1.send(Message{Action: "ready"})
+	for _, player := range []*testClient{p0, p1} {
+		if !player.expectState(0).Started {
+			t.Fatal("game not started once both players were ready")
+		}
+	}
+	return p0, p1
+}
+
+func TestBroadcastImmediate(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	p0.move("P1", "B")
+	for _, player := range []*testClient{p0, p1} {
+		if state := player.expectState(0); state.CurrentPlayer != 1 {
+			t.Fatalf("got player %d to move, want player 1", state.CurrentPlayer)
+		}
+	}
+}
+
+func TestBroadcastBatched(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.BroadcastInterval = Duration(200 * time.Millisecond) })
+	p0, p1 := startGame(t, srv, "room=a")
+
+	// Both moves come in the same interval, so the first state after them
+	// already shows both
+	p0.move("P1", "B")
+	waitForPlayer(t, "a", 1)
+	p1.move("P1", "F")
+	state := p1.expectState(0)
+	if state.CurrentPlayer != 0 || state.Board[1][0] == nil || state.Board[3][0] == nil {
+		t.Fatalf("first state after the moves has player %d to move and board %v, want both moves played", state.CurrentPlayer, state.Board)
+	}
+}
+
+func TestDistinctPlayers(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.DistinctPlayers = true })
+	dial(t, srv, "room=a&user=alice").expectState(0)
+	dial(t, srv, "room=a&user=alice").expectClose(CloseAlreadyPlaying)
+
+	// Another user still gets the second slot
+	bob := dial(t, srv, "room=a&user=bob")
+	if state := bob.expectState(0); state.Players[1].UserID != "bob" {
+		t.Fatalf("second slot went to %q, want bob", state.Players[1].UserID)
+	}
+}
+
+func TestSubprotocolRequired(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.RequireProtocol = true })
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws?room=a"), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("client offering no subprotocol: got %v, want 400 Bad Request", err)
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{"hitwicket.v0", "hitwicket.v1"}}
+	ws, _, err := dialer.Dial(wsURL(srv, "/ws?room=a"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if got := ws.Subprotocol(); got != "hitwicket.v1" {
+		t.Fatalf("negotiated subprotocol %q, want hitwicket.v1", got)
+	}
+}
+
+func TestFailedUpgradeKeepsServing(t *testing.T) {
+	srv := newTestServer(t, nil)
+	resp, err := http.Get(srv.URL + "/ws?room=a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain GET of the WebSocket endpoint got %s", resp.Status)
+	}
+	dial(t, srv, "room=a").expect("state", nil)
+}
+
+func TestMaxSpectators(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.MaxSpectators = 1 })
+	startGame(t, srv, "room=a")
+	dial(t, srv, "room=a").expect("state", nil)
+	dial(t, srv, "room=a").expectClose(CloseRoomFull)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"hitwicket/engine"
+)
+
+// Orders of play for the next game of a match
+const (
+	// rematchSwap gives the first move to the player who moved second
+	rematchSwap   = "swap"
+	rematchKeep   = "keep"
+	rematchRandom = "random"
+)
+
+// Match is a best-of-N series of games played in one room
+type Match struct {
+	BestOf int    `json:"best_of"`
+	Wins   [2]int `json:"wins"`
+	// Results holds the winner of each finished game, NoWinner for draws
+	Results []int `json:"results"`
+	Over    bool  `json:"over"`
+	Winner  int   `json:"winner"`
+}
+
+func newMatch(bestOf int) *Match {
+	return &Match{
+		BestOf:  bestOf,
+		Results: make([]int, 0, bestOf),
+		Winner:  engine.NoWinner,
+	}
+}
+
+// record adds a finished game's result, deciding the match once a player has
+// won more than half of its games
+func (m *Match) record(winner int) {
+	m.Results = append(m.Results, winner)
+	if winner == engine.NoWinner {
+		return
+	}
+	m.Wins[winner]++
+	if m.Wins[winner] > m.BestOf/2 {
+		m.Over = true
+		m.Winner = winner
+	}
+}
+
+// gameEnded stops the AI thinking, keeps a finished game in the store and
+// records it in the room's match and, if the match is still undecided,
+// starts the next game after a pause so clients can show the result. Must be
+// called with room.mu held.
+func (room *Room) gameEnded() {
+	room.cancelAI()
+	room.recordResult()
+	if room.match == nil {
+		return
+	}
+	room.match.record(room.game.Winner)
+	if room.match.Over {
+		room.logEvent("match_over", room.match.Winner, "")
+		return
+	}
+	time.AfterFunc(time.Duration(config.RematchDelay), room.nextGame)
+}
+
+// nextGame starts the next game of the match with the same players
+func (room *Room) nextGame() {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.closed {
+		return
+	}
+
+	room.discardSavedMoves()
+	previous := room.game
+	room.game = engine.NewGame(room.rng, room.options.rules())
+	room.record = nil
+	room.gameID = ""
+	for i, player := range previous.Players {
+		room.game.Players[i].Name = player.Name
+		room.game.Players[i].UserID = player.UserID
+	}
+	room.game.FirstPlayer = room.nextFirstPlayer(previous)
+	room.game.CurrentPlayer = room.game.FirstPlayer
+	room.game.Ready = [2]bool{true, true}
+	room.game.Started = true
+	room.idle = [2]time.Duration{}
+	room.bonusUsed = 0
+	room.turnStart = time.Time{}
+
+	log.Printf("Room %s starting game %d of the match, Player %d to move first", room.ID, len(room.match.Results)+1, room.game.FirstPlayer+1)
+	room.logEvent("start", spectator, "")
+	room.broadcastGameStart()
+	room.startIdleClock()
+	room.scheduleBroadcast()
+	room.playAIMove()
+}
+
+// nextFirstPlayer picks who moves first in the game after previous, following
+// config.RematchOrder. An aborted game is replayed in the same order. Must be
+// called with room.mu held.
+func (room *Room) nextFirstPlayer(previous *engine.Game) int {
+	if previous.GameOverReason == engine.ReasonAborted {
+		return previous.FirstPlayer
+	}
+	switch config.RematchOrder {
+	case rematchKeep:
+		return previous.FirstPlayer
+	case rematchRandom:
+		return room.rng.Intn(2)
+	default:
+		return (previous.FirstPlayer + 1) % 2
+	}
+}
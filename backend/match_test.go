@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+
+	"hitwicket/engine"
+)
+
+func TestMatchRecord(t *testing.T) {
+	m := newMatch(3)
+	m.record(0)
+	m.record(engine.NoWinner)
+	m.record(1)
+	if m.Over {
+		t.Fatal("match over at one win each")
+	}
+	m.record(1)
+	if !m.Over || m.Winner != 1 || m.Wins != [2]int{1, 2} {
+		t.Fatalf("got match %+v, want it won by player 1", m)
+	}
+}
+
+func TestResignGameOfMatch(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) {
+		c.MatchBestOf = 3
+		c.RematchDelay = 0
+	})
+	p0, p1 := startGame(t, srv, "room=a")
+	p0.send(Message{Action: "resign"})
+
+	// Resigning gives up the game, not the match
+	state := p1.expectState(0)
+	for state.GameOver {
+		state = p1.expectState(0)
+	}
+	if state.Match == nil || state.Match.Wins != [2]int{0, 1} || state.Match.Over {
+		t.Fatalf("second game starts with match %+v, want player 1 a game up", state.Match)
+	}
+	p0.send(Message{Action: "resign"})
+	for state.Match == nil || !state.Match.Over {
+		state = p1.expectState(0)
+	}
+	if state.Match.Winner != 1 || len(state.Match.Results) != 2 {
+		t.Fatalf("match ended %+v, want player 1 winning 2-0", state.Match)
+	}
+}
+
+func TestRematchOrder(t *testing.T) {
+	for _, test := range []struct {
+		order string
+		first int
+	}{{rematchSwap, 1}, {rematchKeep, 0}} {
+		t.Run(test.order, func(t *testing.T) {
+			srv := newTestServer(t, func(c *Config) {
+				c.MatchBestOf = 3
+				c.RematchDelay = 0
+				c.RematchOrder = test.order
+			})
+			p0, _ := startGame(t, srv, "room=a")
+			p0.move("P1", "B")
+			p0.expectState(0)
+			p0.send(Message{Action: "resign"})
+			for !p0.expectState(0).GameOver {
+			}
+			state := p0.expectState(0)
+			for state.GameOver {
+				state = p0.expectState(0)
+			}
+			if state.FirstPlayer != test.first || state.CurrentPlayer != test.first {
+				t.Fatalf("second game has player %d moving first, want %d", state.FirstPlayer, test.first)
+			}
+		})
+	}
+}
+
+func TestAbortedGameReplayedInSameOrder(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) {
+		c.MatchBestOf = 3
+		c.RematchDelay = 0
+	})
+	p0, _ := startGame(t, srv, "room=a")
+	p0.send(Message{Action: "abort"})
+	for !p0.expectState(0).GameOver {
+	}
+	state := p0.expectState(0)
+	for state.GameOver {
+		state = p0.expectState(0)
+	}
+	if state.FirstPlayer != 0 || len(state.Match.Results) != 0 {
+		t.Fatalf("after the abort player %d moves first with results %v, want player 0 and none", state.FirstPlayer, state.Match.Results)
+	}
+}
+
+func TestNextGameDiscardsSavedMoves(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.MatchBestOf = 3 })
+	startGame(t, srv, "room=a")
+
+	// Moves left in the store under the finished game's ID don't outlive it
+	room := findRoom("a")
+	room.mu.Lock()
+	room.gameID = "finished"
+	if err := store.AppendMoves("finished", []engine.MoveRecord{{Player: 0, Character: "P1", Direction: "B"}}); err != nil {
+		t.Fatal(err)
+	}
+	room.mu.Unlock()
+	room.nextGame()
+
+	moves, err := store.TakeMoves("finished")
+	if err != nil || len(moves) != 0 {
+		t.Fatalf("store still holds moves %+v, %v for the previous game", moves, err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxNameLength is the longest name, in characters, a player can take
+const maxNameLength = 32
+
+// NameMessage tells the clients a player has changed their name
+type NameMessage struct {
+	Type   string `json:"type"`
+	Player int    `json:"player"`
+	Name   string `json:"name"`
+}
+
+// validateName checks a name a player asked for, once trimmed of surrounding
+// spaces
+func validateName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("name is empty")
+	case utf8.RuneCountInString(name) > maxNameLength:
+		return fmt.Errorf("name is longer than %d characters", maxNameLength)
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return errors.New("name contains control characters")
+	}
+	return nil
+}
+
+// handleSetName renames a player, telling them why if the name is refused.
+// With UniqueNames set, a player can't take the name the opponent has.
+// Spectators are only told the new name if they may see who is playing.
+// Must be called with room.mu held.
+func (room *Room) handleSetName(ws *websocket.Conn, name string, playerID int) {
+	name = strings.TrimSpace(name)
+	if err := validateName(name); err != nil {
+		sendError(ws, err.Error())
+		return
+	}
+	opponent := room.game.Players[(playerID+1)%2]
+	if config.UniqueNames && strings.EqualFold(name, opponent.Name) {
+		sendError(ws, "the opponent already has that name")
+		return
+	}
+	player := room.game.Players[playerID]
+	if name == player.Name {
+		return
+	}
+	log.Printf("Player %d in room %s renamed from %q to %q", playerID+1, room.ID, player.Name, name)
+	player.Name = name
+	room.logEvent("rename", playerID, "")
+
+	msg := NameMessage{Type: "player_name", Player: playerID, Name: name}
+	for client, id := range room.clients {
+		if id == spectator && config.HideIdentities {
+			continue
+		}
+		if err := writeMessage(client, msg); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+	room.scheduleBroadcast()
+}
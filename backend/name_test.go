@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetName(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.UniqueNames = true })
+	p0, p1 := startGame(t, srv, "room=a")
+	watcher := dial(t, srv, "room=a")
+	watcher.expect("state", nil)
+
+	p0.send(Message{Action: "set_name", Name: "  Alice "})
+	var msg NameMessage
+	p1.expect("player_name", &msg)
+	if msg.Player != 0 || msg.Name != "Alice" {
+		t.Fatalf("got rename %+v, want player 0 to Alice", msg)
+	}
+	// The roster everyone is sent carries the name
+	for _, client := range []*testClient{p0, p1, watcher} {
+		state := client.expectState(0)
+		for state.Players[0].Name != "Alice" {
+			state = client.expectState(0)
+		}
+	}
+
+	for _, name := range []string{"", "   ", strings.Repeat("x", maxNameLength+1), "tab\there", "alice"} {
+		p1.send(Message{Action: "set_name", Name: name})
+		p1.expectError()
+	}
+	room := findRoom("a")
+	room.mu.Lock()
+	name := room.game.Players[1].Name
+	room.mu.Unlock()
+	if name == "" || strings.EqualFold(name, "alice") {
+		t.Fatalf("refused names left player 1 named %q", name)
+	}
+}
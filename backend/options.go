@@ -0,0 +1,292 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"hitwicket/engine"
+)
+
+// maxBoardSize is the widest and tallest board a room can be created with
+const maxBoardSize = 16
+
+// RoomOptions are the settings a room can be created with. Rooms created by
+// a player connecting take them from the config.
+type RoomOptions struct {
+	BoardWidth  int      `json:"board_width"`
+	BoardHeight int      `json:"board_height"`
+	Pieces      []string `json:"pieces"`
+	// Placement is where the pieces start on the home row, as described in
+	// placement.go
+	Placement string   `json:"placement,omitempty"`
+	IdleLimit Duration `json:"idle_limit"`
+	// FirstMoveBonus is extra time for the first move of a game, which
+	// doesn't count towards the idle limit
+	FirstMoveBonus Duration `json:"first_move_bonus,omitempty"`
+	// BroadcastInterval coalesces state broadcasts into one per interval, or
+	// sends every change immediately if zero
+	BroadcastInterval Duration `json:"broadcast_interval,omitempty"`
+	// RacePiece turns off captures and makes the game a race to get a
+	// piece of this type onto the opponent's home row
+	RacePiece string `json:"race_piece,omitempty"`
+	// FirstCapture makes the game sudden death, won by the first capture
+	FirstCapture bool `json:"first_capture,omitempty"`
+	// TurnOrder is the order the players take turns in, given as their IDs,
+	// which play follows from turn to turn. It starts the room's first game
+	// with its first player; rematches pick who starts by RematchOrder.
+	// Games only ever have two players, so there is no N-player order: it
+	// must be an order of players 0 and 1.
+	TurnOrder []int `json:"turn_order,omitempty"`
+	// Simultaneous has both players move at once each round, as described
+	// in engine/simultaneous.go
+	Simultaneous bool `json:"simultaneous,omitempty"`
+}
+
+// roomOptions returns the options of rooms created without any
+func (c *Config) roomOptions() RoomOptions {
+	return RoomOptions{
+		BoardWidth:  c.BoardWidth,
+		BoardHeight: c.BoardHeight,
+		Pieces:      slices.Clone(c.Pieces),
+		Placement:   c.Placement,
+		IdleLimit:   c.IdleLimit,
+
+		FirstMoveBonus:    c.FirstMoveBonus,
+		BroadcastInterval: c.BroadcastInterval,
+		RacePiece:         c.RacePiece,
+
+		FirstCapture: c.FirstCapture,
+		Simultaneous: c.Simultaneous,
+	}
+}
+
+// rules are those a game in a room with the options is played by, the rest
+// taken from the config
+func (o RoomOptions) rules() engine.Rules {
+	// validate has already rejected a placement that doesn't fit
+	columns, _ := placementColumns(o.Placement, o.BoardWidth, len(o.Pieces))
+	return engine.Rules{
+		BoardWidth:      o.BoardWidth,
+		BoardHeight:     o.BoardHeight,
+		Pieces:          o.Pieces,
+		Columns:         columns,
+		RandomPlacement: config.RandomPlacement,
+		CustomSetup:     config.CustomSetup,
+		RacePiece:       o.RacePiece,
+		FirstCapture:    o.FirstCapture,
+		Simultaneous:    o.Simultaneous,
+		TurnOrder:       o.TurnOrder,
+		King:            config.King,
+		KingSafety:      config.KingSafety,
+		Strict:          config.Strict,
+		NoTakeback:      config.NoTakeback,
+		AllowSwap:       config.AllowSwap,
+		AllowPass:       config.AllowPass,
+		HeroPush:        config.HeroPush,
+		Guarding:        config.Guarding,
+		NoHero2Jump:     config.NoHero2Jump,
+		NonCapturing:    config.NonCapturing,
+		RespawnTurns:    config.RespawnTurns,
+		MaxMoves:        config.MaxMoves,
+		CaptureTiebreak: config.CaptureTiebreak,
+
+		ImmobilizedLoses: config.ImmobilizedLoses,
+		PieceValues:      config.PieceValues,
+	}
+}
+
+// validate checks the options describe a playable game, with king, if set,
+// appearing once among the pieces
+func (o RoomOptions) validate(king string) error {
+	if o.BoardHeight < 2 {
+		return errors.New("board height must be at least 2")
+	}
+	if o.BoardWidth > maxBoardSize || o.BoardHeight > maxBoardSize {
+		return fmt.Errorf("the board can be at most %dx%d", maxBoardSize, maxBoardSize)
+	}
+	if len(o.Pieces) == 0 {
+		return errors.New("at least one piece is required")
+	}
+	if len(o.Pieces) > o.BoardWidth {
+		return fmt.Errorf("%d pieces do not fit on a board %d wide", len(o.Pieces), o.BoardWidth)
+	}
+	if _, err := placementColumns(o.Placement, o.BoardWidth, len(o.Pieces)); err != nil {
+		return err
+	}
+	for _, charType := range o.Pieces {
+		switch charType {
+		case "Pawn", "Hero1", "Hero2":
+		default:
+			return fmt.Errorf("unknown piece type: %s", charType)
+		}
+	}
+	if king != "" {
+		kings := 0
+		for _, charType := range o.Pieces {
+			if charType == king {
+				kings++
+			}
+		}
+		if kings != 1 {
+			return fmt.Errorf("the king %s must appear exactly once among the pieces", king)
+		}
+	}
+	if o.RacePiece != "" && !slices.Contains(o.Pieces, o.RacePiece) {
+		return fmt.Errorf("the race piece %s is not among the pieces", o.RacePiece)
+	}
+	if o.FirstCapture && o.RacePiece != "" {
+		return errors.New("a race has no captures to win by")
+	}
+	if o.TurnOrder != nil {
+		order := slices.Clone(o.TurnOrder)
+		slices.Sort(order)
+		if !slices.Equal(order, []int{0, 1}) {
+			return fmt.Errorf("turn order %v is not an order of players 0 and 1", o.TurnOrder)
+		}
+	}
+	if o.IdleLimit < 0 {
+		return errors.New("idle limit must not be negative")
+	}
+	if o.FirstMoveBonus < 0 {
+		return errors.New("first move bonus must not be negative")
+	}
+	if o.BroadcastInterval < 0 {
+		return errors.New("broadcast interval must not be negative")
+	}
+	if o.Simultaneous && o.IdleLimit > 0 {
+		return errors.New("simultaneous games cannot have an idle limit")
+	}
+	if o.Simultaneous && config.AI {
+		return errors.New("the AI cannot play simultaneous games")
+	}
+	return nil
+}
+
+// CreatedRoom tells the creator of a room how to join it
+type CreatedRoom struct {
+	RoomID  string      `json:"room_id"`
+	JoinURL string      `json:"join_url"`
+	Options RoomOptions `json:"options"`
+}
+
+// RoomInfo describes an existing room
+type RoomInfo struct {
+	ID      string      `json:"id"`
+	Options RoomOptions `json:"options"`
+	Players int         `json:"players"`
+	Started bool        `json:"started"`
+}
+
+// randomID returns a new random identifier for a room or game
+func randomID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// createRoom adds a room with a new random ID and the given options, created
+// by the client at address creator. The room is kept for AbandonGrace waiting
+// for its first connection.
+func createRoom(opts RoomOptions, creator string) (*Room, error) {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	var id string
+	for id == "" || rooms[id] != nil {
+		var err error
+		if id, err = randomID(); err != nil {
+			return nil, err
+		}
+	}
+	room := newRoom(id, opts)
+	room.creator = creator
+	rooms[id] = room
+
+	time.AfterFunc(time.Duration(config.AbandonGrace), func() {
+		room.mu.Lock()
+		defer room.mu.Unlock()
+		if !room.closed && len(room.clients) == 0 {
+			log.Printf("Room %s was never joined", room.ID)
+			room.close()
+		}
+	})
+	return room, nil
+}
+
+// handleCreateRoom creates a room with the options posted in the body, on top
+// of the configured ones, and replies with where to join it
+func handleCreateRoom(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+	opts := config.roomOptions()
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, config.MaxMessageSize)).Decode(&opts); err != nil {
+		http.Error(w, fmt.Sprintf("invalid room options: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := opts.validate(config.King); err != nil {
+		http.Error(w, fmt.Sprintf("invalid room options: %v", err), http.StatusBadRequest)
+		return
+	}
+	ip := clientIP(r)
+	if !acquireRoom(ip) {
+		log.Printf("Too many rooms created by %s", ip)
+		http.Error(w, "too many open rooms created from your address", http.StatusTooManyRequests)
+		return
+	}
+	room, err := createRoom(opts, ip)
+	if err != nil {
+		releaseRoom(ip)
+		log.Printf("error: %v", err)
+		http.Error(w, "could not create room", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Created room %s", room.ID)
+
+	scheme := "ws"
+	if r.TLS != nil {
+		scheme = "wss"
+	}
+	created := CreatedRoom{
+		RoomID:  room.ID,
+		JoinURL: fmt.Sprintf("%s://%s/ws?room=%s", scheme, r.Host, room.ID),
+		Options: opts,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(created); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+// handleRoomInfo describes a room and the options it was created with
+func handleRoomInfo(w http.ResponseWriter, r *http.Request) {
+	room := findRoom(r.PathValue("id"))
+	if room == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	room.mu.Lock()
+	info := RoomInfo{ID: room.ID, Options: room.options, Started: room.game.Started}
+	for _, id := range room.clients {
+		if id != spectator {
+			info.Players++
+		}
+	}
+	room.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// postRoom asks the server to create a room with the options in body,
+// returning the response status and the room if one was created
+func postRoom(t *testing.T, srv *httptest.Server, body string) (int, CreatedRoom) {
+	t.Helper()
+	resp, err := http.Post(srv.URL+"/rooms", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var created CreatedRoom
+	if resp.StatusCode == http.StatusCreated {
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, created
+}
+
+func TestCreateRoom(t *testing.T) {
+	srv := newTestServer(t, nil)
+	status, created := postRoom(t, srv, `{"board_width": 7, "pieces": ["Pawn", "Hero1", "Pawn"]}`)
+	if status != http.StatusCreated || created.Options.BoardWidth != 7 || created.Options.BoardHeight != 5 {
+		t.Fatalf("got %d %+v, want a 7x5 room", status, created)
+	}
+
+	var info RoomInfo
+	getJSON(t, srv.URL+"/rooms/"+created.RoomID, &info)
+	if info.ID != created.RoomID || len(info.Options.Pieces) != 3 || info.Started {
+		t.Fatalf("room info %+v", info)
+	}
+	state := dial(t, srv, "room="+created.RoomID).expectState(0)
+	if len(state.Board) != 5 || len(state.Board[0]) != 7 {
+		t.Fatalf("joined a %dx%d board, want 7x5", len(state.Board[0]), len(state.Board))
+	}
+}
+
+func TestCreateRoomInvalid(t *testing.T) {
+	srv := newTestServer(t, nil)
+	for _, body := range []string{
+		`{"board_width": 17}`,
+		`{"board_height": 1000000}`,
+		`{"pieces": ["Queen"]}`,
+		`{"pieces": []}`,
+		`{"broadcast_interval": "-1s"}`,
+		`not json`,
+	} {
+		if status, _ := postRoom(t, srv, body); status != http.StatusBadRequest {
+			t.Errorf("room with options %s got %d, want 400", body, status)
+		}
+	}
+}
+
+func TestRoomsPerIPLimit(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.MaxRoomsPerIP = 1 })
+	status, created := postRoom(t, srv, `{}`)
+	if status != http.StatusCreated {
+		t.Fatalf("first room got %d", status)
+	}
+	if status, _ := postRoom(t, srv, `{}`); status != http.StatusTooManyRequests {
+		t.Fatalf("room over the limit got %d, want 429", status)
+	}
+
+	// Closing the room frees its place
+	room := findRoom(created.RoomID)
+	room.mu.Lock()
+	room.close()
+	room.mu.Unlock()
+	if status, _ := postRoom(t, srv, `{}`); status != http.StatusCreated {
+		t.Fatalf("room after the first closed got %d", status)
+	}
+}
+
+func TestTurnOrderOption(t *testing.T) {
+	srv := newTestServer(t, nil)
+	for _, order := range []string{`[0, 0]`, `[0, 1, 0]`, `[1]`, `[0, 2]`} {
+		if status, _ := postRoom(t, srv, `{"turn_order": `+order+`}`); status != http.StatusBadRequest {
+			t.Errorf("turn order %s got %d, want 400", order, status)
+		}
+	}
+
+	status, created := postRoom(t, srv, `{"turn_order": [1, 0]}`)
+	if status != http.StatusCreated {
+		t.Fatalf("room with turn order [1, 0] got %d", status)
+	}
+	p0, p1 := startGame(t, srv, "room="+created.RoomID)
+	p0.move("P1", "B")
+	if got := p0.expectError(); got.Code != "not_your_turn" {
+		t.Fatalf("player 0 moving first got %+v", got)
+	}
+	p1.move("P1", "F")
+	if state := p0.expectState(1); state.CurrentPlayer != 0 {
+		t.Fatalf("after player 1's move player %d is to move, want 0", state.CurrentPlayer)
+	}
+	p0.move("P1", "B")
+	if state := p1.expectState(2); state.CurrentPlayer != 1 {
+		t.Fatalf("after player 0's move player %d is to move, want 1", state.CurrentPlayer)
+	}
+}
+
+func TestBroadcastIntervalOption(t *testing.T) {
+	srv := newTestServer(t, nil)
+	status, created := postRoom(t, srv, `{"broadcast_interval": "200ms"}`)
+	if status != http.StatusCreated || created.Options.BroadcastInterval != Duration(200*time.Millisecond) {
+		t.Fatalf("got %d %+v, want a room batching broadcasts every 200ms", status, created)
+	}
+
+	// The room batches its broadcasts though the config doesn't
+	p0, p1 := startGame(t, srv, "room="+created.RoomID)
+	p0.move("P1", "B")
+	waitForPlayer(t, created.RoomID, 1)
+	p1.move("P1", "F")
+	state := p1.expectState(0)
+	if state.CurrentPlayer != 0 || state.Board[1][0] == nil || state.Board[3][0] == nil {
+		t.Fatalf("first state after the moves has player %d to move and board %v, want both moves played", state.CurrentPlayer, state.Board)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+// flippedPlayer is the player who, with oriented boards enabled, sees the
+// board mirrored top to bottom so that their home row is at the top, as it
+// is for the other player
+const flippedPlayer = 1
+
+// isFlipped reports whether a client sees the board mirrored
+func isFlipped(playerID int) bool {
+	return config.OrientBoards && playerID == flippedPlayer
+}
+
+// flipState mirrors a state top to bottom, copying the characters so that the
+// game itself is left untouched
+func flipState(state GameState) GameState {
+	height := len(state.Board)
+	flipped := make(map[*engine.Character]*engine.Character)
+	flip := func(char *engine.Character) *engine.Character {
+		if char == nil {
+			return nil
+		}
+		if copied, ok := flipped[char]; ok {
+			return copied
+		}
+		copied := *char
+		copied.Y = height - 1 - char.Y
+		flipped[char] = &copied
+		return &copied
+	}
+
+	board := make([][]*engine.Character, height)
+	for y, row := range state.Board {
+		board[height-1-y] = make([]*engine.Character, len(row))
+		for x, char := range row {
+			board[height-1-y][x] = flip(char)
+		}
+	}
+	state.Board = board
+
+	for i, player := range state.Players {
+		copied := *player
+		copied.Characters = make([]*engine.Character, len(player.Characters))
+		for j, char := range player.Characters {
+			copied.Characters[j] = flip(char)
+		}
+		state.Players[i] = &copied
+	}
+
+	if state.LastMove != nil {
+		last := flipMove(*state.LastMove, height)
+		state.LastMove = &last
+	}
+	return state
+}
+
+// flipMove mirrors a recorded move on a board of the given height
+func flipMove(move engine.MoveRecord, height int) engine.MoveRecord {
+	flipped := move
+	flipped.Direction = flipDirection(move.Direction)
+	flipped.From.Y = height - 1 - move.From.Y
+	flipped.To.Y = height - 1 - move.To.Y
+	flipped.Path = make([]engine.Square, len(move.Path))
+	for i, cell := range move.Path {
+		flipped.Path[i] = engine.Square{X: cell.X, Y: height - 1 - cell.Y}
+	}
+	return flipped
+}
+
+// flipDirection converts a direction between a mirrored view and the board.
+// Mirroring swaps forward and backward and leaves left and right alone.
+func flipDirection(direction string) string {
+	switch direction {
+	case "F":
+		return "B"
+	case "B":
+		return "F"
+	case "FL":
+		return "BL"
+	case "FR":
+		return "BR"
+	case "BL":
+		return "FL"
+	case "BR":
+		return "FR"
+	}
+	return direction
+}
+
+// viewFlipped reports whether a client sees the board mirrored: a player if
+// isFlipped says so, and a spectator if they chose to watch from
+// flippedPlayer's side, whether or not boards are oriented for the players.
+// Must be called with room.mu held.
+func (room *Room) viewFlipped(client *websocket.Conn, id int) bool {
+	if id == spectator {
+		return room.spectatorViews[client] == flippedPlayer
+	}
+	return isFlipped(id)
+}
+
+// handleOrient lets a spectator watch from the side of a player. The choice
+// is remembered for their user ID, if they have one, for when they next
+// connect to the room. Must be called with room.mu held.
+func (room *Room) handleOrient(ws *websocket.Conn, view int) {
+	if view != 0 && view != 1 {
+		sendError(ws, fmt.Sprintf("no such player to watch from: %d", view))
+		return
+	}
+	room.setView(ws, view)
+	if userID := room.watchers[ws].userID; userID != "" {
+		if room.userViews == nil {
+			room.userViews = make(map[string]int)
+		}
+		room.userViews[userID] = view
+	}
+	room.sendGameState(ws)
+}
+
+// setView sets the player a spectator watches from the side of. Must be
+// called with room.mu held.
+func (room *Room) setView(ws *websocket.Conn, view int) {
+	if room.spectatorViews == nil {
+		room.spectatorViews = make(map[*websocket.Conn]int)
+	}
+	room.spectatorViews[ws] = view
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// pieceAt finds where a state shows one of a player's pieces
+func pieceAt(state GameState, owner int, name string) (int, int, bool) {
+	for y, row := range state.Board {
+		for x, char := range row {
+			if char != nil && char.Owner == owner && char.Name == name {
+				return x, y, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func TestOrientedBoards(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.OrientBoards = true })
+	p0, p1 := startGame(t, srv, "room=a")
+	p0.move("P1", "B")
+	p0.expectState(0)
+	p1.expectState(0)
+
+	// Player 1 sees their home row at the top, so forward is B for them too
+	p1.move("P1", "B")
+	mine := p1.expectState(0)
+	if x, y, _ := pieceAt(mine, 1, "P1"); x != 0 || y != 1 {
+		t.Errorf("player 1 sees their P1 at (%d,%d), want (0,1)", x, y)
+	}
+
+	theirs := p0.expectState(0)
+	if x, y, _ := pieceAt(theirs, 1, "P1"); x != 0 || y != 3 {
+		t.Errorf("player 0 sees player 1's P1 at (%d,%d), want (0,3)", x, y)
+	}
+}
+
+func TestSpectatorView(t *testing.T) {
+	srv := newTestServer(t, nil)
+	startGame(t, srv, "room=a")
+	sam := dial(t, srv, "room=a&user=sam")
+	if x, y, _ := pieceAt(sam.expectState(0), 0, "P1"); x != 0 || y != 0 {
+		t.Fatalf("spectator sees player 0's P1 at (%d,%d) by default, want (0,0)", x, y)
+	}
+
+	// From player 1's side, player 0's home row is at the bottom
+	sam.send(Message{Action: "orient", View: 1})
+	if x, y, _ := pieceAt(sam.expectState(0), 0, "P1"); x != 0 || y != 4 {
+		t.Fatalf("spectator watching from player 1's side sees player 0's P1 at (%d,%d), want (0,4)", x, y)
+	}
+
+	// The choice outlasts the connection
+	sam.ws.Close()
+	sam = dial(t, srv, "room=a&user=sam")
+	if x, y, _ := pieceAt(sam.expectState(0), 0, "P1"); x != 0 || y != 4 {
+		t.Fatalf("reconnected spectator sees player 0's P1 at (%d,%d), want (0,4)", x, y)
+	}
+	other := dial(t, srv, "room=a&user=other")
+	if x, y, _ := pieceAt(other.expectState(0), 0, "P1"); x != 0 || y != 0 {
+		t.Fatalf("another spectator sees player 0's P1 at (%d,%d), want (0,0)", x, y)
+	}
+
+	sam.send(Message{Action: "orient", View: 2})
+	sam.expectError()
+}
+
+func TestBroadcastComputedPerClient(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.OrientBoards = true })
+	p0, p1 := startGame(t, srv, "room=a")
+
+	// One broadcast sends each player the board from their own side
+	room := findRoom("a")
+	room.mu.Lock()
+	room.broadcastGameState()
+	room.mu.Unlock()
+	if _, y, _ := pieceAt(p0.expectState(0), 0, "P1"); y != 0 {
+		t.Errorf("player 0 sees their P1 on row %d, want 0", y)
+	}
+	if _, y, _ := pieceAt(p1.expectState(0), 0, "P1"); y != 4 {
+		t.Errorf("player 1 sees player 0's P1 on row %d, want 4", y)
+	}
+
+	// Sending to some clients leaves out the rest
+	room.mu.Lock()
+	room.sendToClients(func(id int) bool { return id == 1 })
+	room.mu.Unlock()
+	p1.expectState(0)
+	p0.ws.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := p0.ws.ReadMessage(); err == nil {
+		t.Errorf("player 0 was sent %s", data)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatchOp is a single RFC 6902 JSON Patch operation
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// PatchMessage carries the changes from the last state a client was sent
+type PatchMessage struct {
+	Type  string    `json:"type"`
+	Patch []PatchOp `json:"patch"`
+}
+
+// toJSONValue converts v to the generic form encoding/json decodes into, so
+// that it can be compared field by field.
+func toJSONValue(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	err = json.Unmarshal(data, &value)
+	return value, err
+}
+
+// diffJSON returns the JSON Patch that turns from into to. Both must be
+// generic JSON values as produced by toJSONValue.
+func diffJSON(from, to any) []PatchOp {
+	ops := make([]PatchOp, 0)
+	diffValue("", from, to, &ops)
+	return ops
+}
+
+func diffValue(path string, from, to any, ops *[]PatchOp) {
+	switch fromValue := from.(type) {
+	case map[string]any:
+		if toValue, ok := to.(map[string]any); ok {
+			diffObject(path, fromValue, toValue, ops)
+			return
+		}
+	case []any:
+		// Arrays whose length changed are replaced whole
+		if toValue, ok := to.([]any); ok && len(toValue) == len(fromValue) {
+			for i := range fromValue {
+				diffValue(path+"/"+strconv.Itoa(i), fromValue[i], toValue[i], ops)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(from, to) {
+		*ops = append(*ops, PatchOp{Op: "replace", Path: path, Value: mustMarshal(to)})
+	}
+}
+
+func diffObject(path string, from, to map[string]any, ops *[]PatchOp) {
+	keys := make([]string, 0, len(from)+len(to))
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := path + "/" + escapePointer(key)
+		fromValue, inFrom := from[key]
+		toValue, inTo := to[key]
+		switch {
+		case !inTo:
+			*ops = append(*ops, PatchOp{Op: "remove", Path: keyPath})
+		case !inFrom:
+			*ops = append(*ops, PatchOp{Op: "add", Path: keyPath, Value: mustMarshal(toValue)})
+		default:
+			diffValue(keyPath, fromValue, toValue, ops)
+		}
+	}
+}
+
+// escapePointer escapes a key for use as a JSON Pointer reference token
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// mustMarshal encodes a generic JSON value, which cannot fail
+func mustMarshal(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"hitwicket/engine"
+)
+
+func TestDiffJSON(t *testing.T) {
+	from, _ := toJSONValue(map[string]any{"a": 1, "b": []int{1, 2}, "gone": true, "x/y": 1})
+	to, _ := toJSONValue(map[string]any{"a": 2, "b": []int{1, 3}, "new": "yes", "x/y": 2})
+	var got []string
+	for _, op := range diffJSON(from, to) {
+		got = append(got, op.Op+" "+op.Path+" "+string(op.Value))
+	}
+	want := []string{
+		`replace /a 2`,
+		`replace /b/1 3`,
+		`remove /gone `,
+		`add /new "yes"`,
+		`replace /x~1y 2`,
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got patch %q, want %q", got, want)
+	}
+}
+
+func TestStatePatches(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.StatePatches = true })
+	p0 := dial(t, srv, "room=a")
+	p0.expectState(0)
+	p1 := dial(t, srv, "room=a")
+	p1.expectState(0)
+	p0.send(Message{Action: "ready"})
+	p1.send(Message{Action: "ready"})
+
+	// After the full state, the start of the game and the move come as
+	// patches
+	p1.expectPatch("/started", "true")
+	waitFor(t, func() bool {
+		return inRoom("a", func(g *engine.Game) bool { return g.Started })
+	})
+	p0.move("P1", "B")
+	p1.expectPatch("/current_player", "1")
+}
+
+// expectPatch reads the next patch the server sends, failing the test unless
+// it sets path to value
+func (c *testClient) expectPatch(path, value string) {
+	c.t.Helper()
+	var msg PatchMessage
+	c.expect("patch", &msg)
+	for _, op := range msg.Patch {
+		if op.Path == path {
+			if string(op.Value) != value {
+				c.t.Fatalf("%s patched to %s, want %s", path, op.Value, value)
+			}
+			return
+		}
+	}
+	c.t.Fatalf("patch %+v does not touch %s", msg.Patch, path)
+}
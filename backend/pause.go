@@ -0,0 +1,54 @@
+package main
+
+import "log"
+
+// handlePauseRequest records a player's request for a break and pauses the
+// game once both players have asked. The AI always agrees. Must be called
+// with room.mu held.
+func (room *Room) handlePauseRequest(playerID int) {
+	game := room.game
+	if !game.Started || game.GameOver || game.Paused || game.PauseRequested[playerID] {
+		return
+	}
+	game.PauseRequested[playerID] = true
+	room.logEvent("pause_request", playerID, "")
+	if config.AI {
+		game.PauseRequested[aiPlayer] = true
+	}
+	if game.PauseRequested != [2]bool{true, true} {
+		return
+	}
+
+	log.Printf("Game in room %s paused", room.ID)
+	game.Paused = true
+	game.PauseRequested = [2]bool{}
+	room.cancelAI()
+	room.startIdleClock()
+	room.logEvent("pause", spectator, "")
+	room.scheduleBroadcast()
+}
+
+// handleResume records a player's wish to carry on and resumes a paused game
+// once both players have asked. Must be called with room.mu held.
+func (room *Room) handleResume(playerID int) {
+	game := room.game
+	if !game.Paused || game.GameOver || game.ResumeRequested[playerID] {
+		return
+	}
+	game.ResumeRequested[playerID] = true
+	room.logEvent("resume_request", playerID, "")
+	if config.AI {
+		game.ResumeRequested[aiPlayer] = true
+	}
+	if game.ResumeRequested != [2]bool{true, true} {
+		return
+	}
+
+	log.Printf("Game in room %s resumed", room.ID)
+	game.Paused = false
+	game.ResumeRequested = [2]bool{}
+	room.logEvent("resume", spectator, "")
+	room.startIdleClock()
+	room.scheduleBroadcast()
+	room.playAIMove()
+}
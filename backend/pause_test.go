@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestPauseByAgreement(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+
+	// One player asking isn't enough
+	p0.send(Message{Action: "pause_request"})
+	p0.move("P1", "B")
+	if state := p0.expectState(0); state.Paused {
+		t.Fatal("game paused on one player's request")
+	}
+
+	p1.send(Message{Action: "pause_request"})
+	state := p1.expectState(0)
+	for !state.Paused {
+		state = p1.expectState(0)
+	}
+	p1.move("P1", "F")
+	if reason := p1.expectError().Reason; reason != "game is paused" {
+		t.Fatalf("move while paused got %q", reason)
+	}
+
+	p0.send(Message{Action: "resume"})
+	p1.send(Message{Action: "resume"})
+	for state.Paused {
+		state = p1.expectState(0)
+	}
+	p1.move("P1", "F")
+	if state := p1.expectState(0); state.CurrentPlayer != 0 {
+		t.Fatalf("move after resuming left player %d to move", state.CurrentPlayer)
+	}
+}
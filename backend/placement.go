@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// placementColumns returns the home-row columns a row of pieces starts on for
+// a placement: "left" (or empty) packs them into the leftmost columns,
+// "center" centres them, leaving any odd column over on the right, and a
+// comma-separated list names each piece's column explicitly, counting from 0
+func placementColumns(placement string, width, pieces int) ([]int, error) {
+	columns := make([]int, pieces)
+	switch placement {
+	case "", "left":
+		for i := range columns {
+			columns[i] = i
+		}
+		return columns, nil
+	case "center":
+		offset := (width - pieces) / 2
+		for i := range columns {
+			columns[i] = offset + i
+		}
+		return columns, nil
+	}
+
+	columns = columns[:0]
+	taken := make(map[int]bool)
+	for _, field := range strings.Split(placement, ",") {
+		x, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("unknown placement: %s", placement)
+		}
+		if x < 0 || x >= width {
+			return nil, fmt.Errorf("placement column %d is off a board %d wide", x, width)
+		}
+		if taken[x] {
+			return nil, fmt.Errorf("placement puts two pieces in column %d", x)
+		}
+		taken[x] = true
+		columns = append(columns, x)
+	}
+	if len(columns) != pieces {
+		return nil, fmt.Errorf("placement gives %d columns for %d pieces", len(columns), pieces)
+	}
+	return columns, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPlacementColumns(t *testing.T) {
+	for _, tt := range []struct {
+		placement string
+		width     int
+		want      []int
+	}{
+		{"", 7, []int{0, 1, 2, 3, 4}},
+		{"left", 7, []int{0, 1, 2, 3, 4}},
+		{"center", 7, []int{1, 2, 3, 4, 5}},
+		{"center", 8, []int{1, 2, 3, 4, 5}},
+		{"center", 5, []int{0, 1, 2, 3, 4}},
+		{"6, 0,2,4,5", 7, []int{6, 0, 2, 4, 5}},
+	} {
+		got, err := placementColumns(tt.placement, tt.width, 5)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("placement %q on %d columns: got %v, %v, want %v", tt.placement, tt.width, got, err, tt.want)
+		}
+	}
+	for _, placement := range []string{"right", "0,1,2,3", "0,1,2,3,7", "0,1,2,3,3", "0,1,2,3,-1"} {
+		if _, err := placementColumns(placement, 7, 5); err == nil {
+			t.Errorf("placement %q was accepted", placement)
+		}
+	}
+}
+
+func TestCenteredPlacement(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) {
+		c.BoardWidth = 7
+		c.Placement = "center"
+	})
+	state := dial(t, srv, "room=a").expectState(0)
+	for _, y := range []int{0, len(state.Board) - 1} {
+		for x, cell := range state.Board[y] {
+			if central := x >= 1 && x <= 5; (cell != nil) != central {
+				t.Errorf("home row %d: column %d holds %v", y, x, cell)
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+// CatchUpMessage replays to a reconnecting player the moves played since the
+// version of the game they last saw, so their client can animate them
+type CatchUpMessage struct {
+	Type  string              `json:"type"`
+	Since int                 `json:"since"`
+	Moves []engine.MoveRecord `json:"moves"`
+}
+
+// sendMissedMoves sends a player the moves played after version since of the
+// game. Nothing is sent if since is not a version of the current game, or if
+// some of the moves since have been trimmed from its history; the full state
+// that follows is enough to catch up. Must be called with room.mu held.
+func (room *Room) sendMissedMoves(ws *websocket.Conn, playerID, since int) {
+	moves := room.game.Moves
+	first := since - room.game.Trimmed
+	if first < 0 || first >= len(moves) {
+		return
+	}
+	missed := make([]engine.MoveRecord, len(moves)-first)
+	copy(missed, moves[first:])
+	if isFlipped(playerID) {
+		for i, move := range missed {
+			missed[i] = flipMove(move, len(room.game.Board))
+		}
+	}
+	err := writeMessage(ws, CatchUpMessage{Type: "catch_up", Since: since, Moves: missed})
+	if err != nil {
+		log.Printf("error: %v", err)
+	}
+}
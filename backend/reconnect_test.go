@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestReconnectCatchUp(t *testing.T) {
+	srv := newTestServer(t, nil)
+	alice, bob := startGameWith(t, srv, "room=a&user=alice", "room=a&user=bob")
+	alice.move("P1", "B")
+	alice.expectState(1)
+	alice.ws.Close()
+	waitFor(t, func() bool { return !connected("a")[0] })
+
+	bob.move("P1", "F")
+	bob.expectState(2)
+	alice = dial(t, srv, "room=a&user=alice&since=1")
+	var msg CatchUpMessage
+	alice.expect("catch_up", &msg)
+	if msg.Since != 1 || len(msg.Moves) != 1 || msg.Moves[0].Player != 1 || msg.Moves[0].Character != "P1" {
+		t.Fatalf("got catch up %+v, want bob's P1 move", msg)
+	}
+	if state := alice.expectState(2); state.Version != 2 {
+		t.Fatalf("state after the catch up has version %d, want 2", state.Version)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+// maxReplaySpeed is the fastest a replay plays, as a multiple of normal speed
+const maxReplaySpeed = 16
+
+// ReplayMessage is the position a replay has reached
+type ReplayMessage struct {
+	Type          string                `json:"type"`
+	Board         [][]*engine.Character `json:"board"`
+	Players       [2]*engine.Player     `json:"players"`
+	CurrentPlayer int                   `json:"current_player"`
+	// Index counts the moves played so far, out of Total
+	Index    int                `json:"index"`
+	Total    int                `json:"total"`
+	Playing  bool               `json:"playing"`
+	Speed    float64            `json:"speed"`
+	LastMove *engine.MoveRecord `json:"last_move,omitempty"`
+	// Result and Reason are how the game ended, sent once the replay gets
+	// there
+	Result string `json:"result,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// replayer plays a stored game back to one client, a move at a time. It moves
+// on by itself only while playing, every ReplayInterval divided by its speed.
+type replayer struct {
+	mu      sync.Mutex
+	ws      *websocket.Conn
+	record  GameRecord
+	game    *engine.Game
+	playing bool
+	speed   float64
+	timer   *time.Timer
+}
+
+// newReplayer sets up a stored game at its start position, paused
+func newReplayer(ws *websocket.Conn, record GameRecord) (*replayer, error) {
+	game, err := engine.NewReplay(record.Options.rules(), record.Start, record.FirstPlayer)
+	if err != nil {
+		return nil, err
+	}
+	for i, player := range game.Players {
+		player.Name = record.Players[i]
+	}
+	return &replayer{ws: ws, record: record, game: game, speed: 1}, nil
+}
+
+// index is how many of the game's moves have been played back. Must be
+// called with r.mu held.
+func (r *replayer) index() int {
+	return len(r.game.Moves)
+}
+
+// send tells the client where the replay is. Must be called with r.mu held.
+func (r *replayer) send() {
+	msg := ReplayMessage{
+		Type:          "replay",
+		Board:         r.game.Board,
+		Players:       r.game.Players,
+		CurrentPlayer: r.game.CurrentPlayer,
+		Index:         r.index(),
+		Total:         len(r.record.Moves),
+		Playing:       r.playing,
+		Speed:         r.speed,
+	}
+	if i := r.index(); i > 0 {
+		// The stored move, unlike the replayed one, carries its comments
+		last := r.record.Moves[i-1]
+		msg.LastMove = &last
+	}
+	if msg.Index == msg.Total {
+		msg.Result = r.record.Result
+		msg.Reason = r.record.Reason
+	}
+	if err := writeMessage(r.ws, msg); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+// step plays the next move. A move that can't be played again, because the
+// rules it was played by have changed since, stops the replay there. Must be
+// called with r.mu held.
+func (r *replayer) step() error {
+	i := r.index()
+	if i >= len(r.record.Moves) {
+		return errors.New("the replay is over")
+	}
+	if err := r.game.Replay(r.record.Moves[i]); err != nil {
+		log.Printf("Replay of game %s stopped at move %d: %v", r.record.ID, i, err)
+		return fmt.Errorf("move %d cannot be replayed: %w", i, err)
+	}
+	return nil
+}
+
+// schedule sets the timer for the next move, if the replay is playing. Must
+// be called with r.mu held.
+func (r *replayer) schedule() {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	if !r.playing {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Duration(float64(config.ReplayInterval)/r.speed), func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.timer != timer {
+			return
+		}
+		if err := r.step(); err != nil {
+			sendErrorFor(r.ws, err)
+			r.playing = false
+		}
+		if r.index() == len(r.record.Moves) {
+			r.playing = false
+		}
+		r.schedule()
+		r.send()
+	})
+	r.timer = timer
+}
+
+// handle carries out one of the client's controls. Must be called with
+// r.mu held.
+func (r *replayer) handle(msg Message) {
+	switch msg.Action {
+	case "play":
+		if r.index() == len(r.record.Moves) {
+			sendError(r.ws, "the replay is over")
+			return
+		}
+		r.playing = true
+	case "pause":
+		r.playing = false
+	case "step":
+		r.playing = false
+		if err := r.step(); err != nil {
+			sendErrorFor(r.ws, err)
+		}
+	case "speed":
+		if msg.Speed <= 0 || msg.Speed > maxReplaySpeed {
+			sendError(r.ws, fmt.Sprintf("speed must be above 0 and at most %d", maxReplaySpeed))
+			return
+		}
+		r.speed = msg.Speed
+	default:
+		sendError(r.ws, fmt.Sprintf("unknown replay action: %s", msg.Action))
+		return
+	}
+	r.schedule()
+	r.send()
+}
+
+// run reads the client's controls until they disconnect
+func (r *replayer) run() {
+	lastHeartbeat := time.Now()
+	for {
+		r.ws.SetReadDeadline(readDeadline(0, lastHeartbeat))
+		_, data, err := r.ws.ReadMessage()
+		r.mu.Lock()
+		if err != nil {
+			missedHeartbeat(r.ws, lastHeartbeat)
+			r.playing = false
+			r.schedule()
+			r.mu.Unlock()
+			return
+		}
+		var msg Message
+		if err := codecFor(r.ws).Decode(data, &msg); err != nil {
+			log.Printf("Malformed message: %v", err)
+			sendError(r.ws, fmt.Sprintf("malformed message: %v", err))
+		} else if msg.Action == "heartbeat" {
+			lastHeartbeat = time.Now()
+		} else {
+			r.handle(msg)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// handleReplay plays a stored game back over a WebSocket. The replay starts
+// paused at the start position, in board orientation, and the client
+// controls it with the play, pause, step and speed actions.
+func handleReplay(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	record, err := store.LoadGame(id)
+	if errors.Is(err, ErrGameNotFound) {
+		http.Error(w, "game not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, "could not load game", http.StatusInternalServerError)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("error: %v", err)
+		return
+	}
+	defer ws.Close()
+	ws.SetReadLimit(config.MaxMessageSize)
+
+	ip := clientIP(r)
+	if !acquireConn(ip) {
+		log.Printf("Too many connections from %s", ip)
+		closeConn(ws, CloseTooManyConns, "too many connections from your address")
+		return
+	}
+	defer releaseConn(ip)
+
+	rp, err := newReplayer(ws, record)
+	if err != nil {
+		log.Printf("Cannot replay game %s: %v", id, err)
+		closeConn(ws, websocket.CloseUnsupportedData, fmt.Sprintf("cannot replay game: %v", err))
+		return
+	}
+	log.Printf("Replaying game %s to %s", id, ws.RemoteAddr())
+	rp.mu.Lock()
+	rp.send()
+	rp.mu.Unlock()
+	rp.run()
+}
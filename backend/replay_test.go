@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialReplay opens the replay of a stored game
+func dialReplay(t *testing.T, srv *httptest.Server, id string) *testClient {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/games/"+id+"/replay"), nil)
+	if err != nil {
+		t.Fatalf("dial replay of %s: %v", id, err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return &testClient{t: t, ws: ws}
+}
+
+// sameBoard reports whether two boards hold the same pieces on the same
+// squares
+func sameBoard(t *testing.T, a, b any) bool {
+	t.Helper()
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(aJSON) == string(bJSON)
+}
+
+func TestReplay(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.ReplayInterval = Duration(10 * time.Millisecond) })
+	p0, p1 := startGame(t, srv, "room=a")
+	start := dial(t, srv, "room=a").expectState(0)
+	p0.move("P1", "B")
+	afterFirst := p1.expectState(1)
+	p1.move("P1", "F")
+	p0.expectState(2)
+	p0.send(Message{Action: "resign"})
+	p0.expectGameOver()
+	records, err := store.ListGames()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("stored games %+v, %v, want one", records, err)
+	}
+
+	replay := dialReplay(t, srv, records[0].ID)
+	var msg ReplayMessage
+	replay.expect("replay", &msg)
+	if msg.Index != 0 || msg.Total != 2 || msg.Playing || !sameBoard(t, msg.Board, start.Board) {
+		t.Fatalf("replay opened at move %d of %d, playing %v, want paused at the start position", msg.Index, msg.Total, msg.Playing)
+	}
+
+	replay.send(Message{Action: "step"})
+	replay.expect("replay", &msg)
+	if msg.Index != 1 || !sameBoard(t, msg.Board, afterFirst.Board) {
+		t.Fatalf("after a step the replay is at move %d with board %v, want move 1 and the board after it", msg.Index, msg.Board)
+	}
+	if msg.LastMove == nil || msg.LastMove.Character != "P1" || msg.LastMove.Direction != "B" {
+		t.Fatalf("after a step the last move is %+v, want P1 B", msg.LastMove)
+	}
+
+	// Playing goes on to the end by itself
+	replay.send(Message{Action: "play"})
+	for msg.Index < msg.Total {
+		replay.expect("replay", &msg)
+	}
+	if msg.Playing || msg.Result != "0-1" {
+		t.Fatalf("replay ended playing %v with result %q, want stopped at 0-1", msg.Playing, msg.Result)
+	}
+	replay.send(Message{Action: "step"})
+	replay.expectError()
+}
+
+func TestReplayUnknownGame(t *testing.T) {
+	srv := newTestServer(t, nil)
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, "/games/missing/replay"), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("replay of a game never stored: got %v, want 404 Not Found", err)
+	}
+}
@@ -0,0 +1,982 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+// defaultRoomID is the room a client joins when it doesn't name one
+const defaultRoomID = "default"
+
+// maxRoomIDLength is the longest room ID a client may name
+const maxRoomIDLength = 64
+
+// validRoomID reports whether a room ID named by a client is acceptable: at
+// most maxRoomIDLength letters, digits, hyphens and underscores, so that it
+// is safe to use in URLs and file names
+func validRoomID(id string) bool {
+	if id == "" || len(id) > maxRoomIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Room is a single game together with the clients connected to it
+type Room struct {
+	ID      string
+	options RoomOptions
+
+	// mu guards every field below
+	mu      sync.Mutex
+	game    *engine.Game
+	clients map[*websocket.Conn]int
+
+	// lastSent holds the last state sent to each client when state patches are
+	// enabled, as the base for the next patch
+	lastSent map[*websocket.Conn]any
+
+	// replaced holds connections whose player slot was taken over by a newer
+	// connection of the same user, so that their leaving is not mistaken for
+	// the player's
+	replaced map[*websocket.Conn]bool
+
+	// watchers holds who each spectator is, so that they can be kicked
+	watchers map[*websocket.Conn]watcher
+
+	// spectatorViews holds the player each spectator chose to watch from
+	// the side of, and userViews the same for each spectator's user ID, so
+	// that their choice survives a reconnect
+	spectatorViews map[*websocket.Conn]int
+	userViews      map[string]int
+
+	// kickedUsers and kickedAddrs hold, for each user ID and address a
+	// spectator was kicked from the room with, when they may watch it again
+	kickedUsers map[string]time.Time
+	kickedAddrs map[string]time.Time
+
+	// nextWatcher numbers the spectators who have joined the room
+	nextWatcher int
+
+	// delayed holds the messages waiting for the spectator delay to pass
+	// before they are sent to each spectator
+	delayed map[*websocket.Conn][]delayedMessage
+
+	broadcastPending bool
+	spectatorPending bool
+	abandonTimer     *time.Timer
+	forfeitTimers    [2]*time.Timer
+	events           eventLog
+
+	// match is the series being played, or nil for a single game
+	match *Match
+
+	// record is the current game as it was saved to the store once it
+	// ended, or nil while it is being played
+	record *GameRecord
+
+	// gameID is the ID the current game is stored under, given to it once
+	// its oldest moves are first saved to make room in its history
+	gameID string
+
+	// rng drives random piece placement
+	rng *rand.Rand
+
+	// idle is the time each player has spent on their turns this game, not
+	// counting the turn in progress, which turnPlayer started at turnStart
+	idle       [2]time.Duration
+	turnPlayer int
+	turnStart  time.Time
+	idleTimer  *time.Timer
+	clockTimer *time.Timer
+
+	// turnBonus is the time the turn in progress may take without counting
+	// towards the idle limit, which is what is left of the first move bonus
+	// on move one. bonusUsed is how much of the bonus has been used up.
+	turnBonus time.Duration
+	bonusUsed time.Duration
+
+	// drawTimers withdraw each player's draw offer once it has stood for
+	// DrawOfferTimeout
+	drawTimers [2]*time.Timer
+
+	// aiCancel stops the AI's search while it is thinking
+	aiCancel context.CancelFunc
+
+	// closed is set once the room has been removed from rooms, so that a
+	// client that looked it up just before can go and find its replacement
+	closed bool
+
+	// creator is the address of the client that created the room through
+	// POST /rooms, which counts towards its MaxRoomsPerIP until closed
+	creator string
+}
+
+var (
+	rooms = make(map[string]*Room)
+
+	// roomsMu guards rooms. It is never acquired while holding a room's mu
+	// except to remove that room.
+	roomsMu sync.Mutex
+)
+
+func newRoom(id string, opts RoomOptions) *Room {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+	room := &Room{
+		ID:       id,
+		options:  opts,
+		game:     engine.NewGame(rng, opts.rules()),
+		clients:  make(map[*websocket.Conn]int),
+		lastSent: make(map[*websocket.Conn]any),
+		rng:      rng,
+	}
+	if config.MatchBestOf > 1 {
+		room.match = newMatch(config.MatchBestOf)
+	}
+	return room
+}
+
+// lockRoom returns the room with the given ID, creating it if needed, with its
+// mu held
+func lockRoom(id string) *Room {
+	for {
+		roomsMu.Lock()
+		room, ok := rooms[id]
+		if !ok {
+			room = newRoom(id, config.roomOptions())
+			rooms[id] = room
+		}
+		roomsMu.Unlock()
+
+		room.mu.Lock()
+		if !room.closed {
+			return room
+		}
+		room.mu.Unlock()
+	}
+}
+
+// findRoom returns an existing room, or nil if there is none with that ID
+func findRoom(id string) *Room {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	return rooms[id]
+}
+
+// close removes the room from rooms. Must be called with room.mu held.
+func (room *Room) close() {
+	if room.closed {
+		return
+	}
+	room.closed = true
+	if room.creator != "" {
+		releaseRoom(room.creator)
+	}
+	room.stopIdleClock()
+	room.cancelAI()
+	// The game will never finish to collect the moves it saved
+	room.discardSavedMoves()
+	roomsMu.Lock()
+	if rooms[room.ID] == room {
+		delete(rooms, room.ID)
+	}
+	roomsMu.Unlock()
+}
+
+// play reads a player's messages until they disconnect. With debug set, the
+// player is sent a trace explaining each move that was rejected.
+func (room *Room) play(ws *websocket.Conn, playerID int, debug bool) {
+	invalidMoves := 0
+	lastHeartbeat := time.Now()
+	for {
+		ws.SetReadDeadline(readDeadline(config.ReadTimeout, lastHeartbeat))
+		msg, err := room.readMessage(ws)
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("error: %v", err)
+			}
+			room.mu.Lock()
+			if missedHeartbeat(ws, lastHeartbeat) {
+				room.logEvent("kick", playerID, "no heartbeat")
+			} else if isTimeout(err) {
+				closeConn(ws, CloseIdle, "idle")
+				room.logEvent("kick", playerID, "idle")
+			}
+			room.removeClient(ws, playerID)
+			room.mu.Unlock()
+			break
+		}
+
+		room.mu.Lock()
+		if _, ok := room.clients[ws]; !ok {
+			// The connection was dropped or replaced while the message was
+			// being read
+			room.mu.Unlock()
+			continue
+		}
+		switch msg.Action {
+		case "heartbeat":
+			lastHeartbeat = time.Now()
+		case "":
+			if err := room.handleMove(ws, msg.Move, playerID); err != nil {
+				invalidMoves++
+				if debug {
+					room.sendTrace(ws, msg.Move, playerID, err)
+				}
+			} else {
+				invalidMoves = 0
+			}
+		case "ready":
+			room.handleReady(playerID)
+		case "my_pieces":
+			room.sendPieces(ws, playerID)
+		case "mobility":
+			room.sendMobility(ws)
+		case "threats":
+			room.sendThreats(ws, playerID)
+		case "captures":
+			room.sendCaptures(ws)
+		case "kick":
+			if !room.kickSpectator(msg.User, playerID) {
+				sendError(ws, fmt.Sprintf("no spectator connected as %s", msg.User))
+			}
+		case "resign":
+			room.handleResign(playerID)
+		case "abort":
+			room.handleAbort(playerID)
+		case "offer_draw":
+			room.handleOfferDraw(playerID)
+		case "accept_draw":
+			room.handleAcceptDraw(ws, playerID)
+		case "pause_request":
+			room.handlePauseRequest(playerID)
+		case "resume":
+			room.handleResume(playerID)
+		case "setup":
+			room.handleSetup(ws, msg.Setup, playerID)
+		case "select":
+			room.handleSelect(ws, msg.CharacterName, playerID)
+		case "resync":
+			room.handleResync(ws)
+		case "annotate":
+			room.handleAnnotate(ws, msg.MoveIndex, msg.Text, playerID)
+		case "set_name":
+			room.handleSetName(ws, msg.Name, playerID)
+		case "pass":
+			if err := room.handlePass(ws, playerID); err != nil {
+				invalidMoves++
+			} else {
+				invalidMoves = 0
+			}
+		case "swap":
+			if err := room.handleSwap(ws, msg.A, msg.B, playerID); err != nil {
+				invalidMoves++
+			} else {
+				invalidMoves = 0
+			}
+		default:
+			sendError(ws, fmt.Sprintf("unknown action: %s", msg.Action))
+		}
+
+		if config.MaxInvalidMoves > 0 && invalidMoves >= config.MaxInvalidMoves {
+			log.Printf("Player %d sent %d invalid moves in a row, disconnecting", playerID, invalidMoves)
+			room.logEvent("kick", playerID, "too many invalid moves")
+			code := CloseKicked
+			if config.Strict && room.game.Started && !room.game.GameOver {
+				room.endGame((playerID+1)%2, engine.ReasonForfeit)
+				code = CloseForfeit
+			}
+			closeConn(ws, code, "too many invalid moves")
+			room.removeClient(ws, playerID)
+			room.mu.Unlock()
+			break
+		}
+		room.mu.Unlock()
+	}
+}
+
+// readMessage reads a client's next message. A message that can't be decoded
+// is answered with an error and skipped, so the only errors returned are
+// those of a connection that has failed.
+func (room *Room) readMessage(ws *websocket.Conn) (Message, error) {
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return Message{}, err
+		}
+		var msg Message
+		if err := codecFor(ws).Decode(data, &msg); err != nil {
+			log.Printf("Malformed message: %v", err)
+			room.mu.Lock()
+			sendError(ws, fmt.Sprintf("malformed message: %v", err))
+			room.mu.Unlock()
+			continue
+		}
+		return msg, nil
+	}
+}
+
+// watch reads from a spectator until they disconnect. Spectators only receive
+// broadcasts, so anything they send is rejected.
+func (room *Room) watch(ws *websocket.Conn) {
+	lastHeartbeat := time.Now()
+	for {
+		ws.SetReadDeadline(readDeadline(0, lastHeartbeat))
+		msg, err := room.readMessage(ws)
+		if err != nil {
+			room.mu.Lock()
+			missedHeartbeat(ws, lastHeartbeat)
+			room.removeClient(ws, spectator)
+			room.mu.Unlock()
+			return
+		}
+		room.mu.Lock()
+		switch msg.Action {
+		case "heartbeat":
+			lastHeartbeat = time.Now()
+		case "resync":
+			room.handleResync(ws)
+		case "orient":
+			room.handleOrient(ws, msg.View)
+		default:
+			sendError(ws, "spectators cannot play")
+		}
+		room.mu.Unlock()
+	}
+}
+
+// spectators counts the connections watching the room. Must be called with
+// room.mu held.
+func (room *Room) spectators() int {
+	n := 0
+	for _, id := range room.clients {
+		if id == spectator {
+			n++
+		}
+	}
+	return n
+}
+
+// freePlayerSlot returns the player slot a new connection should take, or
+// spectator if none is free. Once a game has started, a slot claimed by a
+// user can only be retaken by the same user. Must be called with room.mu held.
+func (room *Room) freePlayerSlot(userID string) int {
+	if room.game.GameOver {
+		return spectator
+	}
+	connected := room.connectedPlayers()
+	for id, player := range room.game.Players {
+		if connected[id] || (config.AI && id == aiPlayer) {
+			continue
+		}
+		if room.game.Started && player.UserID != "" && player.UserID != userID {
+			continue
+		}
+		return id
+	}
+	return spectator
+}
+
+// connectedPlayers reports which players currently have a connection. Must be
+// called with room.mu held.
+func (room *Room) connectedPlayers() [2]bool {
+	connected := [2]bool{}
+	for _, id := range room.clients {
+		if id != spectator {
+			connected[id] = true
+		}
+	}
+	return connected
+}
+
+// replaceConnection closes a user's live connection to a player slot so that
+// a new connection can take the slot over, returning the slot, or spectator
+// if the user holds none. Must be called with room.mu held.
+func (room *Room) replaceConnection(userID string) int {
+	for ws, id := range room.clients {
+		if id == spectator || room.game.Players[id].UserID != userID {
+			continue
+		}
+		log.Printf("User %s reconnected, replacing their old connection", userID)
+		room.logEvent("replace", id, userID)
+		closeConn(ws, CloseReplaced, "replaced by a new connection")
+		ws.Close()
+		delete(room.clients, ws)
+		delete(room.lastSent, ws)
+		if room.replaced == nil {
+			room.replaced = make(map[*websocket.Conn]bool)
+		}
+		room.replaced[ws] = true
+		return id
+	}
+	return spectator
+}
+
+// addPlayer seats a connection in a player slot, cancelling any pending
+// forfeit or abandonment. Must be called with room.mu held.
+func (room *Room) addPlayer(ws *websocket.Conn, playerID int, userID string) {
+	room.game.Players[playerID].UserID = userID
+	room.clients[ws] = playerID
+	if room.abandonTimer != nil {
+		room.abandonTimer.Stop()
+		room.abandonTimer = nil
+	}
+	if room.forfeitTimers[playerID] != nil {
+		room.forfeitTimers[playerID].Stop()
+		room.forfeitTimers[playerID] = nil
+	}
+	room.logEvent("join", playerID, userID)
+}
+
+// removeClient forgets a disconnected client. A player leaving a game in
+// progress forfeits if they don't return in time, and the game is abandoned
+// once no players are left. A room nobody is in and without a game in
+// progress is closed straight away. Must be called with room.mu held.
+func (room *Room) removeClient(ws *websocket.Conn, playerID int) {
+	if room.replaced[ws] {
+		delete(room.replaced, ws)
+		return
+	}
+	delete(room.clients, ws)
+	delete(room.lastSent, ws)
+	delete(room.delayed, ws)
+	delete(room.watchers, ws)
+	delete(room.spectatorViews, ws)
+	room.logEvent("leave", playerID, "")
+
+	inProgress := room.game.Started && !room.game.GameOver
+	if len(room.clients) == 0 && !inProgress {
+		room.close()
+		return
+	}
+	if playerID == spectator {
+		return
+	}
+	if !room.game.Started {
+		room.game.Ready[playerID] = false
+	}
+	if !inProgress {
+		return
+	}
+	if config.ForfeitGrace > 0 {
+		room.forfeitTimers[playerID] = time.AfterFunc(time.Duration(config.ForfeitGrace), func() {
+			room.forfeitDisconnected(playerID)
+		})
+	}
+	if room.connectedPlayers() == [2]bool{} {
+		room.abandonTimer = time.AfterFunc(time.Duration(config.AbandonGrace), room.abandon)
+	}
+}
+
+// forfeitDisconnected ends the game against a player who left it and didn't
+// come back, unless they reconnected in the meantime.
+func (room *Room) forfeitDisconnected(playerID int) {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.connectedPlayers()[playerID] || !room.game.Started || room.game.GameOver {
+		return
+	}
+	log.Printf("Player %d forfeits after disconnecting", playerID)
+	room.forfeitTimers[playerID] = nil
+	room.endGame((playerID+1)%2, engine.ReasonForfeit)
+}
+
+// abandon ends and closes a room whose game every player has left, unless
+// someone reconnected in the meantime. The game is saved as abandoned, and
+// the spectators still watching are sent how it ended and disconnected.
+func (room *Room) abandon() {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.connectedPlayers() != [2]bool{} || !room.game.Started || room.game.GameOver {
+		return
+	}
+	log.Printf("Game in room %s abandoned", room.ID)
+	room.abandonTimer = nil
+	room.logEvent("abandon", spectator, "")
+	room.game.EndGame(engine.NoWinner, engine.ReasonAbandoned)
+	room.stopIdleClock()
+	room.logEvent("game_over", engine.NoWinner, engine.ReasonAbandoned)
+	room.gameEnded()
+	for client := range room.clients {
+		if err := room.writeGameState(client); err != nil {
+			log.Printf("error: %v", err)
+		}
+		closeConn(client, CloseAbandoned, "game abandoned")
+		client.Close()
+	}
+	room.close()
+}
+
+// endGame finishes the game outside of normal play and tells everyone. Must be
+// called with room.mu held.
+func (room *Room) endGame(winner int, reason string) {
+	room.game.EndGame(winner, reason)
+	room.stopIdleClock()
+	room.logEvent("game_over", winner, reason)
+	room.gameEnded()
+	room.scheduleBroadcast()
+}
+
+// handleMove applies a move sent by a player, returning an error if the move
+// was rejected. Must be called with room.mu held.
+func (room *Room) handleMove(ws *websocket.Conn, move engine.Move, playerID int) error {
+	game := room.game
+	if !game.Started {
+		sendErrorFor(ws, engine.ErrGameNotStarted)
+		return engine.ErrGameNotStarted
+	}
+	if move.Nonce != "" && move.Nonce == game.LastNonce[playerID] {
+		err := writeMessage(ws, AckMessage{Type: "ack", Nonce: move.Nonce, Status: "already_applied"})
+		if err != nil {
+			log.Printf("error: %v", err)
+		}
+		return nil
+	}
+	if game.Paused {
+		sendErrorFor(ws, engine.ErrGamePaused)
+		return engine.ErrGamePaused
+	}
+	if game.GameOver {
+		room.sendGameOver(ws)
+		return engine.ErrGameOver
+	}
+	if game.CurrentPlayer != playerID && !game.Rules.Simultaneous {
+		sendErrorFor(ws, engine.ErrNotYourTurn)
+		return engine.ErrNotYourTurn
+	}
+
+	direction, ok := normalizeDirection(move.Direction)
+	if !ok {
+		err := fmt.Errorf("%w: %s", engine.ErrUnknownDirection, move.Direction)
+		sendErrorFor(ws, err)
+		return err
+	}
+	move.Direction = direction
+	if isFlipped(playerID) {
+		move.Direction = flipDirection(move.Direction)
+	}
+	if game.Rules.Simultaneous {
+		return room.submitMove(ws, move, playerID)
+	}
+	err := game.ProcessMove(move, playerID)
+	if err != nil {
+		log.Println(err)
+		sendErrorFor(ws, err)
+		room.logEvent("error", playerID, err.Error())
+	} else {
+		if move.Nonce != "" {
+			game.LastNonce[playerID] = move.Nonce
+		}
+		room.logMove(playerID, fmt.Sprintf("%s %s", move.CharacterName, move.Direction))
+		room.moveApplied()
+		room.startIdleClock()
+	}
+	room.scheduleBroadcast()
+	room.playAIMove()
+	return err
+}
+
+// moveApplied follows up a move that has just been played: if it ended the
+// game the room's game is ended, and otherwise the history is kept within
+// its cap. Must be called with room.mu held.
+func (room *Room) moveApplied() {
+	if room.game.GameOver {
+		room.gameEnded()
+		return
+	}
+	room.trimHistory()
+}
+
+// sendGameOver tells a client whose move arrived after the game ended that
+// it is over, and how it ended. Must be called with room.mu held.
+func (room *Room) sendGameOver(ws *websocket.Conn) {
+	err := writeMessage(ws, ErrorMessage{
+		Type:   "error",
+		Reason: engine.ErrGameOver.Error(),
+		Code:   engine.ErrorCode(engine.ErrGameOver),
+		Result: room.game.Result(),
+	})
+	if err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+// normalizeDirection maps a direction token or one of its configured aliases,
+// in any case, to the token itself
+func normalizeDirection(direction string) (string, bool) {
+	if slices.Contains(engine.Directions, direction) {
+		return direction, true
+	}
+	for alias, canonical := range config.DirectionAliases {
+		if strings.EqualFold(alias, direction) {
+			return canonical, true
+		}
+	}
+	return "", false
+}
+
+// handleReady marks a player as ready and starts the game once both connected
+// players are. Must be called with room.mu held.
+func (room *Room) handleReady(playerID int) {
+	game := room.game
+	if game.Started {
+		return
+	}
+	game.Ready[playerID] = true
+	room.logEvent("ready", playerID, "")
+
+	connected := room.connectedPlayers()
+	if config.AI {
+		connected[aiPlayer] = true
+		game.Ready[aiPlayer] = true
+	}
+	for i := range game.Ready {
+		if !connected[i] || !game.Ready[i] {
+			return
+		}
+	}
+
+	game.Started = true
+	room.logEvent("start", spectator, "")
+	room.broadcastGameStart()
+	room.startIdleClock()
+	room.scheduleBroadcast()
+	room.playAIMove()
+}
+
+// handleResign ends the game in the opponent's favour. Must be called with
+// room.mu held.
+func (room *Room) handleResign(playerID int) {
+	if !room.game.Started || room.game.GameOver {
+		return
+	}
+	room.endGame((playerID+1)%2, engine.ReasonResignation)
+}
+
+// handleSwap exchanges two of a player's adjacent pieces, using up their swap
+// for the game and their turn. Must be called with room.mu held.
+func (room *Room) handleSwap(ws *websocket.Conn, nameA, nameB string, playerID int) error {
+	game := room.game
+	if !game.Started {
+		sendErrorFor(ws, engine.ErrGameNotStarted)
+		return engine.ErrGameNotStarted
+	}
+	if game.Paused {
+		sendErrorFor(ws, engine.ErrGamePaused)
+		return engine.ErrGamePaused
+	}
+	if game.GameOver {
+		room.sendGameOver(ws)
+		return engine.ErrGameOver
+	}
+	if game.CurrentPlayer != playerID {
+		sendErrorFor(ws, engine.ErrNotYourTurn)
+		return engine.ErrNotYourTurn
+	}
+
+	err := game.ProcessSwap(nameA, nameB, playerID)
+	if err != nil {
+		log.Println(err)
+		sendErrorFor(ws, err)
+		room.logEvent("error", playerID, err.Error())
+	} else {
+		room.logMove(playerID, fmt.Sprintf("swap %s %s", nameA, nameB))
+		room.moveApplied()
+		room.startIdleClock()
+	}
+	room.scheduleBroadcast()
+	room.playAIMove()
+	return err
+}
+
+// handlePass gives up a player's turn, if passing is allowed. Must be called
+// with room.mu held.
+func (room *Room) handlePass(ws *websocket.Conn, playerID int) error {
+	game := room.game
+	if !game.Started {
+		sendErrorFor(ws, engine.ErrGameNotStarted)
+		return engine.ErrGameNotStarted
+	}
+	if game.Paused {
+		sendErrorFor(ws, engine.ErrGamePaused)
+		return engine.ErrGamePaused
+	}
+	if game.GameOver {
+		room.sendGameOver(ws)
+		return engine.ErrGameOver
+	}
+	if game.CurrentPlayer != playerID {
+		sendErrorFor(ws, engine.ErrNotYourTurn)
+		return engine.ErrNotYourTurn
+	}
+
+	err := game.ProcessPass(playerID)
+	if err != nil {
+		sendErrorFor(ws, err)
+		room.logEvent("error", playerID, err.Error())
+		return err
+	}
+	room.logMove(playerID, "pass")
+	room.moveApplied()
+	room.startIdleClock()
+	room.scheduleBroadcast()
+	room.playAIMove()
+	return nil
+}
+
+// sendPieces tells a player about each of their surviving pieces and its legal
+// moves. Must be called with room.mu held.
+func (room *Room) sendPieces(client *websocket.Conn, playerID int) {
+	game := room.game
+	pieces := make([]PieceInfo, 0, len(game.Players[playerID].Characters))
+	for _, char := range game.Players[playerID].Characters {
+		piece := PieceInfo{
+			Type:  char.Type,
+			Name:  char.Name,
+			X:     char.X,
+			Y:     char.Y,
+			Moves: game.LegalDirections(char),
+		}
+		if isFlipped(playerID) {
+			piece.Y = len(game.Board) - 1 - char.Y
+			for i, direction := range piece.Moves {
+				piece.Moves[i] = flipDirection(direction)
+			}
+		}
+		pieces = append(pieces, piece)
+	}
+	err := writeMessage(client, PiecesMessage{Type: "pieces", Pieces: pieces})
+	if err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+// sendMobility tells a client how many legal moves each player has in the
+// current position. The whole board is visible to both players, so this
+// gives nothing away. Must be called with room.mu held.
+func (room *Room) sendMobility(client *websocket.Conn) {
+	msg := MobilityMessage{Type: "mobility"}
+	for playerID := range msg.Moves {
+		msg.Moves[playerID] = len(room.game.LegalMoves(playerID))
+	}
+	if err := writeMessage(client, msg); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+// sendCaptures tells a client which pieces each player has captured. Must be
+// called with room.mu held.
+func (room *Room) sendCaptures(client *websocket.Conn) {
+	if err := writeMessage(client, CapturesMessage{Type: "captures", Captures: room.game.Captures()}); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+// sendThreats tells a player which cells the opponent threatens. As with
+// mobility, the whole board is visible to both players, so this gives nothing
+// away. Must be called with room.mu held.
+func (room *Room) sendThreats(client *websocket.Conn, playerID int) {
+	threats := room.game.Threats(playerID)
+	if isFlipped(playerID) {
+		slices.Reverse(threats)
+	}
+	if err := writeMessage(client, ThreatsMessage{Type: "threats", Threats: threats}); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+// scheduleBroadcast sends the game state to all clients, either immediately or,
+// when the room has a broadcast interval, coalesced with any other changes made
+// before the interval elapses. The state sent is always the latest one.
+// Must be called with room.mu held.
+func (room *Room) scheduleBroadcast() {
+	if room.options.BroadcastInterval <= 0 {
+		room.broadcastGameState()
+		return
+	}
+	if room.broadcastPending {
+		return
+	}
+	room.broadcastPending = true
+	time.AfterFunc(time.Duration(room.options.BroadcastInterval), func() {
+		room.mu.Lock()
+		defer room.mu.Unlock()
+		room.broadcastPending = false
+		room.broadcastGameState()
+	})
+}
+
+// broadcastGameState sends the game state to every client, except that with a
+// spectator interval configured spectators are sent it at most once per
+// interval.
+func (room *Room) broadcastGameState() {
+	if config.SpectatorInterval <= 0 {
+		room.sendToClients(func(int) bool { return true })
+		return
+	}
+	room.sendToClients(func(id int) bool { return id != spectator })
+	if room.spectatorPending {
+		return
+	}
+	room.spectatorPending = true
+	time.AfterFunc(time.Duration(config.SpectatorInterval), func() {
+		room.mu.Lock()
+		defer room.mu.Unlock()
+		room.spectatorPending = false
+		room.sendToClients(func(id int) bool { return id == spectator })
+	})
+}
+
+// sendToClients sends the game state to the clients whose player ID matches,
+// each computed for the client it is sent to. Clients whose write fails are
+// dropped once everyone else has been sent the state.
+func (room *Room) sendToClients(match func(id int) bool) {
+	var failed []*websocket.Conn
+	for client, id := range room.clients {
+		if !match(id) {
+			continue
+		}
+		if err := room.writeGameState(client); err != nil {
+			log.Printf("error: %v", err)
+			failed = append(failed, client)
+		}
+	}
+	for _, client := range failed {
+		room.dropClient(client)
+	}
+}
+
+func (room *Room) sendGameState(client *websocket.Conn) {
+	if err := room.writeGameState(client); err != nil {
+		log.Printf("error: %v", err)
+		room.dropClient(client)
+	}
+}
+
+// anonymizeState hides who is playing, replacing each player's name with a
+// generic one and dropping their user ID. The players are copied so that the
+// game itself is left untouched.
+func anonymizeState(state GameState) GameState {
+	for i, player := range state.Players {
+		copied := *player
+		copied.Name = fmt.Sprintf("Player %d", i+1)
+		copied.UserID = ""
+		state.Players[i] = &copied
+	}
+	return state
+}
+
+// dropClient closes a client whose connection has failed. Its read loop then
+// sees the closed connection and cleans up after it.
+func (room *Room) dropClient(client *websocket.Conn) {
+	client.Close()
+	delete(room.clients, client)
+	delete(room.lastSent, client)
+	delete(room.delayed, client)
+}
+
+// writeGameState sends a client the game state as stateFor computes it for
+// them. Must be called with room.mu held.
+func (room *Room) writeGameState(client *websocket.Conn) error {
+	return room.writeState(client, room.stateFor(client))
+}
+
+// stateFor computes the game state as a client is to see it, which depends on
+// who they are: mirrored for those who see the board flipped, and for
+// spectators without the players' identities or the move history if those
+// are hidden. Must be called with room.mu held.
+func (room *Room) stateFor(client *websocket.Conn) GameState {
+	game := room.game
+	state := GameState{
+		Type:          "state",
+		Board:         game.Board,
+		Players:       game.Players,
+		CurrentPlayer: game.CurrentPlayer,
+		FirstPlayer:   game.FirstPlayer,
+		Version:       game.MoveCount(),
+		GameOver:      game.GameOver,
+		Winner:        game.Winner,
+		Started:       game.Started,
+		Paused:        game.Paused,
+
+		GameOverReason: game.GameOverReason,
+		Match:          room.match,
+	}
+	if len(game.Moves) > 0 {
+		state.LastMove = &game.Moves[len(game.Moves)-1]
+	}
+	for playerID, move := range game.Pending {
+		if move != nil {
+			state.Submitted = append(state.Submitted, playerID)
+		}
+	}
+	for playerID, offered := range game.DrawOffered {
+		if offered {
+			state.DrawOffers = append(state.DrawOffers, playerID)
+		}
+	}
+	if id, ok := room.clients[client]; ok && room.viewFlipped(client, id) {
+		state = flipState(state)
+	}
+	if id := room.clients[client]; id == spectator && config.HideIdentities {
+		state = anonymizeState(state)
+	}
+	if id := room.clients[client]; id == spectator && config.HideHistory {
+		// Spectators see none of the moves until the game is over, and then
+		// all of them
+		if game.GameOver {
+			state.Transcript = game.Transcript(room.ID)
+		} else {
+			state.LastMove = nil
+		}
+	}
+	return state
+}
+
+// writeState sends a client a state computed for them by stateFor, or
+// the changes to it with patches enabled. Must be called with room.mu held.
+func (room *Room) writeState(client *websocket.Conn, state GameState) error {
+	state.Checksum = stateChecksum(state)
+
+	// With patches enabled, clients get the full state once and then only
+	// what changed since the last state they were sent
+	var msg any = state
+	if config.StatePatches {
+		value, err := toJSONValue(state)
+		if err != nil {
+			return err
+		}
+		if last, ok := room.lastSent[client]; ok {
+			patch := diffJSON(last, value)
+			if len(patch) == 0 {
+				return nil
+			}
+			msg = PatchMessage{Type: "patch", Patch: patch}
+		}
+		room.lastSent[client] = value
+	}
+
+	if room.clients[client] == spectator && config.SpectatorDelay > 0 {
+		return room.sendDelayed(client, msg)
+	}
+	return writeMessage(client, msg)
+}
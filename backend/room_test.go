@@ -0,0 +1,572 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+func TestMoveBeforeReadyRejected(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0 := dial(t, srv, "room=a")
+	p0.expectState(0)
+	p1 := dial(t, srv, "room=a")
+	p1.expectState(0)
+
+	p0.move("P1", "B")
+	if reason := p0.expectError().Reason; reason != "waiting for opponent" {
+		t.Fatalf("move before the start got %q", reason)
+	}
+
+	// One player being ready isn't enough
+	p0.send(Message{Action: "ready"})
+	p0.move("P1", "B")
+	if reason := p0.expectError().Reason; reason != "waiting for opponent" {
+		t.Fatalf("move with one player ready got %q", reason)
+	}
+
+	p1.send(Message{Action: "ready"})
+	if !p0.expectState(0).Started {
+		t.Fatal("game not started once both players were ready")
+	}
+	p0.move("P1", "B")
+	if state := p0.expectState(0); state.CurrentPlayer != 1 {
+		t.Fatalf("move after both were ready left player %d to move", state.CurrentPlayer)
+	}
+}
+
+func TestAbandonedGameReset(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.AbandonGrace = Duration(50 * time.Millisecond) })
+	p0, p1 := startGame(t, srv, "room=a")
+	p0.move("P1", "B")
+	p0.expectState(0)
+
+	p0.ws.Close()
+	p1.ws.Close()
+	waitFor(t, func() bool { return findRoom("a") == nil })
+
+	// The next players get a fresh game
+	p0 = dial(t, srv, "room=a")
+	if state := p0.expectState(0); state.Board[0][0] == nil || state.Board[1][0] != nil || state.CurrentPlayer != 0 {
+		t.Fatalf("abandoned game was not reset: %+v", state)
+	}
+}
+
+func TestAbandonedGameSavedAndSpectatorsClosed(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.AbandonGrace = Duration(50 * time.Millisecond) })
+	p0, p1 := startGame(t, srv, "room=a")
+	watcher := dial(t, srv, "room=a")
+	watcher.expect("state", nil)
+	p0.move("P1", "B")
+	watcher.expectState(1)
+
+	p0.ws.Close()
+	p1.ws.Close()
+	state := watcher.expectState(1)
+	for !state.GameOver {
+		state = watcher.expectState(1)
+	}
+	if state.GameOverReason != engine.ReasonAbandoned || state.Winner != engine.NoWinner {
+		t.Fatalf("abandoned game ended with winner %d by %q", state.Winner, state.GameOverReason)
+	}
+	watcher.expectClose(CloseAbandoned)
+
+	games, err := store.ListGames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 1 || games[0].Reason != engine.ReasonAbandoned || len(games[0].Moves) != 1 {
+		t.Fatalf("store holds %+v, want the abandoned game with its move", games)
+	}
+	if findRoom("a") != nil {
+		t.Error("the abandoned room is still open")
+	}
+}
+
+func TestMyPieces(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, _ := startGame(t, srv, "room=a")
+	p0.send(Message{Action: "my_pieces"})
+	var msg PiecesMessage
+	p0.expect("pieces", &msg)
+	if len(msg.Pieces) != 5 {
+		t.Fatalf("got %d pieces, want 5", len(msg.Pieces))
+	}
+	want := map[string][]string{"P1": {"B"}, "H2": {"B"}, "H4": {"BL", "BR"}}
+	for _, piece := range msg.Pieces {
+		if moves, ok := want[piece.Name]; ok && !slices.Equal(piece.Moves, moves) {
+			t.Errorf("%s at (%d,%d) can move %v, want %v", piece.Name, piece.X, piece.Y, piece.Moves, moves)
+		}
+	}
+}
+
+func TestMobility(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, _ := startGame(t, srv, "room=a")
+	p0.send(Message{Action: "mobility"})
+	var msg MobilityMessage
+	p0.expect("mobility", &msg)
+	if msg.Moves != [2]int{6, 6} {
+		t.Fatalf("got mobility %v at the start, want 6 moves each", msg.Moves)
+	}
+
+	// Off the home row, P3 can step back, left and right as well as on
+	p0.move("P3", "B")
+	p0.expectState(1)
+	p0.send(Message{Action: "mobility"})
+	p0.expect("mobility", &msg)
+	if msg.Moves[0] != 9 {
+		t.Fatalf("got mobility %v after P3 moved, want 9 for player 0", msg.Moves)
+	}
+}
+
+func TestInvalidMoveSpamDisconnects(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.MaxInvalidMoves = 3 })
+	p0, _ := startGame(t, srv, "room=a")
+	for i := 0; i < 3; i++ {
+		p0.move("P1", "F")
+	}
+	p0.expectClose(CloseKicked)
+}
+
+func TestInvalidMoveSpamForfeitsWhenStrict(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) {
+		c.MaxInvalidMoves = 3
+		c.Strict = true
+	})
+	p0, p1 := startGame(t, srv, "room=a")
+	// A valid move in between starts the count again
+	p0.move("P1", "L")
+	p0.move("P1", "L")
+	p0.move("P1", "B")
+	waitForPlayer(t, "a", 1)
+	p1.move("P1", "F")
+	waitForPlayer(t, "a", 0)
+	p0.move("P1", "L")
+	p0.move("P1", "B")
+	waitForPlayer(t, "a", 1)
+
+	for i := 0; i < 3; i++ {
+		p1.move("P1", "L")
+	}
+	p1.expectClose(CloseForfeit)
+	state := p0.expectState(0)
+	for !state.GameOver {
+		state = p0.expectState(0)
+	}
+	if state.Winner != 0 {
+		t.Fatalf("game ended with winner %d, want a forfeit to player 0", state.Winner)
+	}
+}
+
+func TestResentNonceAcknowledged(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	move := Message{Move: engine.Move{CharacterName: "P1", Direction: "B", Nonce: "n1"}}
+	p0.send(move)
+	p0.expectState(0)
+
+	p0.send(move)
+	var ack AckMessage
+	p0.expect("ack", &ack)
+	if ack.Nonce != "n1" || ack.Status != "already_applied" {
+		t.Fatalf("got ack %+v", ack)
+	}
+
+	// The resend changed nothing: player 1 is still to move and P1 only
+	// moved once
+	p1.expectState(0)
+	p1.move("P1", "F")
+	state := p1.expectState(0)
+	if state.CurrentPlayer != 0 || state.Board[1][0] == nil || state.Board[2][0] != nil {
+		t.Fatalf("after player 1's move: player %d to move, board %v", state.CurrentPlayer, state.Board)
+	}
+}
+
+func TestOversizedMessageCloses(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.MaxMessageSize = 64 })
+	p0 := dial(t, srv, "room=a")
+	p0.expectState(0)
+	p0.move(strings.Repeat("x", 100), "B")
+	p0.expectClose(websocket.CloseMessageTooBig)
+}
+
+func TestReadTimeoutCloses(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.ReadTimeout = Duration(100 * time.Millisecond) })
+	p0 := dial(t, srv, "room=a")
+	p0.expectClose(CloseIdle)
+}
+
+func TestAIMovesAfterSwap(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) {
+		c.AI = true
+		c.AIDepth = 1
+		c.AllowSwap = true
+	})
+	p0 := dial(t, srv, "room=a")
+	p0.expect("state", nil)
+	p0.send(Message{Action: "ready"})
+	p0.expect("game_start", nil)
+	p0.send(Message{Action: "swap", A: "P1", B: "H2"})
+	state := p0.expectState(2)
+	if state.CurrentPlayer != 0 || state.LastMove.Player != aiPlayer {
+		t.Fatalf("after the swap player %d is to move and the last move was player %d's", state.CurrentPlayer, state.LastMove.Player)
+	}
+}
+
+func TestLastMoveInState(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	if state := dial(t, srv, "room=a").expectState(0); state.LastMove != nil {
+		t.Fatalf("state before any move has last move %+v", state.LastMove)
+	}
+	p0.move("H2", "B")
+	last := p1.expectState(0).LastMove
+	want := engine.MoveRecord{Player: 0, Character: "H2", Direction: "B", From: engine.Square{X: 1, Y: 0}, To: engine.Square{X: 1, Y: 2}}
+	if last == nil || last.Player != want.Player || last.Character != want.Character || last.Direction != want.Direction || last.From != want.From || last.To != want.To {
+		t.Fatalf("got last move %+v, want %+v", last, want)
+	}
+}
+
+func TestDirectionAliases(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, _ := startGame(t, srv, "room=a")
+	p0.move("P1", "sideways")
+	p0.expectError()
+	p0.move("P1", "Down")
+	if state := p0.expectState(0); state.Board[1][0] == nil || state.Board[1][0].Name != "P1" {
+		t.Fatal("P1 moved down didn't reach (0,1)")
+	}
+
+	cfg := defaultConfig()
+	cfg.DirectionAliases = map[string]string{"north": "N"}
+	if err := cfg.validate(); err == nil {
+		t.Fatal("alias for an unknown direction was accepted")
+	}
+}
+
+func TestSpectatorInterval(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.SpectatorInterval = Duration(200 * time.Millisecond) })
+	p0, p1 := startGame(t, srv, "room=a")
+	watcher := dial(t, srv, "room=a")
+	watcher.expect("state", nil)
+
+	// Players get each move straight away, the spectator only the last of
+	// the interval
+	p0.move("P1", "B")
+	p1.expectState(0)
+	p1.move("P1", "F")
+	p0.expectState(0)
+	var state GameState
+	watcher.expect("state", &state)
+	if p1 := state.Board[3][0]; p1 == nil || p1.Owner != 1 || state.CurrentPlayer != 0 {
+		t.Fatal("spectator's first state after the moves doesn't show the second one")
+	}
+}
+
+func TestMalformedMessageAnswered(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, _ := startGame(t, srv, "room=a")
+	if err := p0.ws.WriteMessage(websocket.TextMessage, []byte("{not json")); err != nil {
+		t.Fatal(err)
+	}
+	if reason := p0.expectError().Reason; !strings.HasPrefix(reason, "malformed message") {
+		t.Fatalf("malformed message got %q", reason)
+	}
+
+	// The connection is still open
+	p0.move("P1", "B")
+	p0.expectState(0)
+}
+
+func TestErrorCodes(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	p1.move("P1", "F")
+	if code := p1.expectError().Code; code != "not_your_turn" {
+		t.Errorf("move out of turn got code %q", code)
+	}
+	p0.move("P1", "sideways")
+	if code := p0.expectError().Code; code != "unknown_direction" {
+		t.Errorf("move in an unknown direction got code %q", code)
+	}
+	p0.move("P1", "F")
+	if code := p0.expectError().Code; code != "out_of_bounds" {
+		t.Errorf("move off the board got code %q", code)
+	}
+}
+
+func TestGameOverReasonInState(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	p0.send(Message{Action: "resign"})
+	state := p1.expectState(0)
+	if !state.GameOver || state.Winner != 1 || state.GameOverReason != engine.ReasonResignation {
+		t.Fatalf("resigned game: over %v, winner %d, reason %q", state.GameOver, state.Winner, state.GameOverReason)
+	}
+}
+
+func TestReplacedConnection(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.ReplaceConns = true })
+	alice, _ := startGameWith(t, srv, "room=a&user=alice", "room=a&user=bob")
+	again := dial(t, srv, "room=a&user=alice")
+	again.expectState(0)
+	alice.expectClose(CloseReplaced)
+
+	again.move("P1", "B")
+	state := again.expectState(0)
+	for state.CurrentPlayer != 1 {
+		state = again.expectState(0)
+	}
+	if state.Players[0].UserID != "alice" {
+		t.Fatalf("new connection's move left slot 0 held by %q", state.Players[0].UserID)
+	}
+	if got := connected("a"); got != [2]bool{true, true} {
+		t.Fatalf("connected players %v after the replacement, want both", got)
+	}
+}
+
+func TestIdentitiesHiddenFromSpectators(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.HideIdentities = true })
+	alice, bob := startGameWith(t, srv, "room=a&user=alice", "room=a&user=bob")
+	watcher := dial(t, srv, "room=a")
+	state := watcher.expectState(0)
+	for i, player := range state.Players {
+		if player.UserID != "" || player.Name != fmt.Sprintf("Player %d", i+1) {
+			t.Errorf("spectator sees player %d as %q, user %q", i, player.Name, player.UserID)
+		}
+	}
+
+	alice.move("P1", "B")
+	if state := bob.expectState(0); state.Players[0].UserID != "alice" {
+		t.Fatalf("opponent sees player 0 as user %q, want alice", state.Players[0].UserID)
+	}
+}
+
+func TestMoveAfterGameOver(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	p1.send(Message{Action: "resign"})
+	for !p0.expectState(0).GameOver {
+	}
+	p0.move("P1", "B")
+	msg := p0.expectError()
+	if msg.Code != engine.ErrorCode(engine.ErrGameOver) || msg.Result != "1-0" {
+		t.Fatalf("move after the game got %+v, want game over with the result 1-0", msg)
+	}
+}
+
+func TestHistoryHiddenFromSpectators(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.HideHistory = true })
+	p0, p1 := startGame(t, srv, "room=a")
+	watcher := dial(t, srv, "room=a")
+	watcher.expect("state", nil)
+	p0.move("P1", "B")
+	if state := watcher.expectState(1); state.LastMove != nil || state.Transcript != "" {
+		t.Fatalf("spectator sees last move %+v and transcript %q during the game", state.LastMove, state.Transcript)
+	}
+	if state := p1.expectState(1); state.LastMove == nil {
+		t.Fatal("player doesn't see the last move")
+	}
+
+	resp, err := http.Get(srv.URL + "/rooms/a/transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("transcript during the game got %s", resp.Status)
+	}
+	var events []Event
+	getJSON(t, srv.URL+"/rooms/a/events", &events)
+	for _, event := range events {
+		if event.Type == "move" {
+			t.Fatalf("events during the game include the move %+v", event)
+		}
+	}
+
+	p1.send(Message{Action: "resign"})
+	state := watcher.expectState(1)
+	for !state.GameOver {
+		state = watcher.expectState(1)
+	}
+	if !strings.Contains(state.Transcript, "1. P1-B") {
+		t.Fatalf("spectator's transcript once the game is over:\n%s", state.Transcript)
+	}
+}
+
+func TestDisconnectedPlayerSlotHeld(t *testing.T) {
+	srv := newTestServer(t, nil)
+	alice, _ := startGameWith(t, srv, "room=a&user=alice", "room=a&user=bob")
+	alice.ws.Close()
+	waitFor(t, func() bool { return !connected("a")[0] })
+
+	carol := dial(t, srv, "room=a&user=carol")
+	carol.expectState(0)
+	carol.move("P1", "B")
+	if reason := carol.expectError().Reason; reason != "spectators cannot play" {
+		t.Fatalf("newcomer moving in a held slot got %q", reason)
+	}
+
+	alice = dial(t, srv, "room=a&user=alice")
+	alice.expectState(0)
+	alice.move("P1", "B")
+	if state := alice.expectState(0); state.Players[0].UserID != "alice" || state.CurrentPlayer != 1 {
+		t.Fatalf("slot 0 belongs to %q and player %d is to move after alice came back and moved", state.Players[0].UserID, state.CurrentPlayer)
+	}
+}
+
+func TestDisconnectedPlayerForfeits(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.ForfeitGrace = Duration(50 * time.Millisecond) })
+	alice, bob := startGameWith(t, srv, "room=a&user=alice", "room=a&user=bob")
+	bob.ws.Close()
+	state := alice.expectState(0)
+	if !state.GameOver || state.Winner != 0 || state.GameOverReason != engine.ReasonForfeit {
+		t.Fatalf("game ended with winner %d by %q, want a forfeit to player 0", state.Winner, state.GameOverReason)
+	}
+
+	// Back too late, bob can only watch
+	bob = dial(t, srv, "room=a&user=bob")
+	bob.expectState(0)
+	bob.send(Message{Action: "resign"})
+	if reason := bob.expectError().Reason; reason != "spectators cannot play" {
+		t.Fatalf("forfeited player coming back got %q", reason)
+	}
+}
+
+func TestRoomsPlaySeparateGames(t *testing.T) {
+	srv := newTestServer(t, nil)
+	a0, _ := startGame(t, srv, "room=a")
+	b0, _ := startGame(t, srv, "room=b")
+	a0.move("P1", "B")
+	a0.expectState(0)
+
+	b0.move("H2", "B")
+	state := b0.expectState(0)
+	if state.Board[1][0] != nil || state.Board[2][1] == nil {
+		t.Fatalf("room b's board shows room a's move: %v", state.Board)
+	}
+}
+
+func TestFailedWriteDropsOnlyThatClient(t *testing.T) {
+	srv := newTestServer(t, nil)
+	_, p1 := startGame(t, srv, "room=a")
+	watcher := dial(t, srv, "room=a")
+	watcher.expectState(0)
+
+	room := findRoom("a")
+	room.mu.Lock()
+	var broken *websocket.Conn
+	for ws, id := range room.clients {
+		if id == 0 {
+			broken = ws
+		}
+	}
+	broken.Close()
+	room.broadcastGameState()
+	_, stillThere := room.clients[broken]
+	n := len(room.clients)
+	room.mu.Unlock()
+
+	if stillThere || n != 2 {
+		t.Fatalf("after the failed write the room has %d clients, the failed one among them: %v", n, stillThere)
+	}
+	p1.expectState(0)
+	watcher.expectState(0)
+}
+
+func TestFirstCaptureReason(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.FirstCapture = true })
+	p0, p1 := startGame(t, srv, "room=a")
+	p0.move("P1", "B")
+	p1.expectState(1)
+	p1.move("P1", "F")
+	p0.expectState(2)
+	p0.move("P1", "B")
+	p1.expectState(3)
+	p1.move("P1", "F")
+	if state := p0.expectGameOver(); state.Winner != 1 || state.GameOverReason != engine.ReasonFirstCapture {
+		t.Fatalf("game over with winner %d by %q, want player 1 by first capture", state.Winner, state.GameOverReason)
+	}
+}
+
+func TestMultiCaptureBroadcast(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+
+	// Player 1 brings two pawns onto the squares player 0's H2 passes and
+	// lands on, while player 0 marks time
+	replies := []string{"P1 F", "P1 F", "P1 R", "P3 F", "P3 F", "P3 F", "P3 L"}
+	for i, reply := range replies {
+		p0.move("P5", []string{"B", "F"}[i%2])
+		p1.expectState(2*i + 1)
+		name, direction, _ := strings.Cut(reply, " ")
+		p1.move(name, direction)
+		p0.expectState(2*i + 2)
+	}
+	p0.move("H2", "B")
+	move := p1.expectState(2*len(replies) + 1).LastMove
+	if move == nil || !move.MultiCapture || len(move.Captured) != 2 {
+		t.Fatalf("got last move %+v, want a double capture", move)
+	}
+}
+
+func TestCapturesAction(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	for i, move := range []struct {
+		player    *testClient
+		direction string
+	}{{p0, "B"}, {p1, "F"}, {p0, "B"}, {p1, "F"}} {
+		move.player.move("P1", move.direction)
+		move.player.expectState(i + 1)
+	}
+
+	want := []engine.CapturedPiece{{Name: "P1", Type: "Pawn"}}
+	p0.send(Message{Action: "captures"})
+	var msg CapturesMessage
+	p0.expect("captures", &msg)
+	if len(msg.Captures[0]) != 0 || !slices.Equal(msg.Captures[1], want) {
+		t.Fatalf("got captures %+v, want %+v for player 1", msg.Captures, want)
+	}
+
+	// The captures are kept with the finished game
+	p0.send(Message{Action: "resign"})
+	p0.expectGameOver()
+	records, err := store.ListGames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !slices.Equal(records[0].Captures[1], want) {
+		t.Fatalf("stored games %+v, want one with player 1's capture", records)
+	}
+}
+
+func TestRoomIDs(t *testing.T) {
+	for _, id := range []string{"a", "Game-2_b", strings.Repeat("x", maxRoomIDLength)} {
+		if !validRoomID(id) {
+			t.Errorf("room ID %q rejected", id)
+		}
+	}
+	for _, id := range []string{"", "../a", "a/b", "a b", "a.b", "café", strings.Repeat("x", maxRoomIDLength+1)} {
+		if validRoomID(id) {
+			t.Errorf("room ID %q accepted", id)
+		}
+	}
+
+	srv := newTestServer(t, nil)
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws?room=..%2Fa"), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("joining room ../a: got %v, want 400 Bad Request", err)
+	}
+	if findRoom("../a") != nil {
+		t.Fatal("room ../a was created")
+	}
+	dial(t, srv, "room=Game-2_b").expect("state", nil)
+}
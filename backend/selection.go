@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+// handleSelect shows spectators, and the opponent if selections are shared,
+// the piece the player to move has picked up and its legal destinations. An
+// empty name clears the selection. Must be called with room.mu held.
+func (room *Room) handleSelect(ws *websocket.Conn, name string, playerID int) {
+	game := room.game
+	if !game.Started || game.GameOver || game.CurrentPlayer != playerID {
+		sendErrorFor(ws, engine.ErrNotYourTurn)
+		return
+	}
+
+	msg := SelectionMessage{Type: "selection", Player: playerID}
+	if name != "" {
+		char := game.FindCharacter(name, playerID)
+		if char == nil {
+			sendErrorFor(ws, fmt.Errorf("%w: %s", engine.ErrInvalidCharacter, name))
+			return
+		}
+		if config.TouchMove && !game.Rules.Simultaneous && game.TouchBound() == nil {
+			game.Touched = char.Name
+		}
+		msg.Character = char.Name
+		msg.From = &engine.Square{X: char.X, Y: char.Y}
+		msg.Targets = make([]engine.Square, 0)
+		for _, direction := range game.LegalDirections(char) {
+			x, y := engine.CalculateNewPosition(char, direction)
+			msg.Targets = append(msg.Targets, engine.Square{X: x, Y: y})
+		}
+	}
+
+	for client, id := range room.clients {
+		if id == spectator || (config.ShareSelection && id != playerID) {
+			room.sendSelection(client, id, msg)
+		}
+	}
+}
+
+// sendSelection sends a selection to a client, mirrored if they see the
+// board flipped and held back by the spectator delay if they are watching
+func (room *Room) sendSelection(client *websocket.Conn, viewer int, msg SelectionMessage) {
+	if room.viewFlipped(client, viewer) && msg.Character != "" {
+		height := len(room.game.Board)
+		msg.From = &engine.Square{X: msg.From.X, Y: height - 1 - msg.From.Y}
+		targets := make([]engine.Square, len(msg.Targets))
+		for i, target := range msg.Targets {
+			targets[i] = engine.Square{X: target.X, Y: height - 1 - target.Y}
+		}
+		msg.Targets = targets
+	}
+	send := writeMessage
+	if viewer == spectator && config.SpectatorDelay > 0 {
+		send = room.sendDelayed
+	}
+	if err := send(client, msg); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"hitwicket/engine"
+)
+
+func TestSelectionShownToSpectators(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, p1 := startGame(t, srv, "room=a")
+	watcher := dial(t, srv, "room=a")
+	watcher.expect("state", nil)
+
+	p0.send(Message{Action: "select", Move: engine.Move{CharacterName: "H4"}})
+	var msg SelectionMessage
+	watcher.expect("selection", &msg)
+	want := []engine.Square{{X: 2, Y: 2}, {X: 4, Y: 2}}
+	if msg.Player != 0 || msg.Character != "H4" || *msg.From != (engine.Square{X: 3, Y: 0}) || !slices.Equal(msg.Targets, want) {
+		t.Fatalf("got selection %+v, want H4 from (3,0) to %v", msg, want)
+	}
+
+	// The opponent isn't shown it unless selections are shared
+	p0.move("H4", "BL")
+	for {
+		typ, data := p1.next()
+		if typ == "selection" {
+			t.Fatalf("opponent was shown the selection %s", data)
+		}
+		var state GameState
+		if typ == "state" && json.Unmarshal(data, &state) == nil && state.CurrentPlayer == 1 {
+			break
+		}
+	}
+
+	p0.expectState(0)
+	p0.send(Message{Action: "select", Move: engine.Move{CharacterName: "P1"}})
+	if reason := p0.expectError().Reason; reason != "not your turn" {
+		t.Fatalf("select out of turn got %q", reason)
+	}
+}
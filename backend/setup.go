@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+// handleSetup arranges a player's pieces as they asked, telling them why if
+// the setup was rejected. Must be called with room.mu held.
+func (room *Room) handleSetup(ws *websocket.Conn, pieces []engine.SetupPiece, playerID int) {
+	if isFlipped(playerID) {
+		flipped := make([]engine.SetupPiece, len(pieces))
+		for i, piece := range pieces {
+			piece.Y = len(room.game.Board) - 1 - piece.Y
+			flipped[i] = piece
+		}
+		pieces = flipped
+	}
+	if err := room.game.ApplySetup(playerID, pieces); err != nil {
+		log.Println(err)
+		room.logEvent("error", playerID, err.Error())
+		sendError(ws, err.Error())
+		return
+	}
+	room.logEvent("setup", playerID, "")
+	room.scheduleBroadcast()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout is how long the server waits for HTTP requests still being
+// served when it is stopped
+const shutdownTimeout = 5 * time.Second
+
+// closeAllConns disconnects every client in every room with CloseShutdown.
+// WebSocket connections have been hijacked from the HTTP server, so
+// http.Server.Shutdown leaves them open and they have to be closed here.
+func closeAllConns() {
+	roomsMu.Lock()
+	open := make([]*Room, 0, len(rooms))
+	for _, room := range rooms {
+		open = append(open, room)
+	}
+	roomsMu.Unlock()
+
+	for _, room := range open {
+		room.mu.Lock()
+		for client := range room.clients {
+			closeConn(client, CloseShutdown, "server shutting down")
+			client.Close()
+		}
+		room.mu.Unlock()
+	}
+}
+
+// serve runs srv until ctx is done, then stops taking requests and
+// disconnects every client before returning
+func serve(ctx context.Context, srv *http.Server) error {
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	closeAllConns()
+	return err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+// SubmittedMessage tells the clients a player has chosen their move for the
+// round, without saying what it is
+type SubmittedMessage struct {
+	Type   string `json:"type"`
+	Player int    `json:"player"`
+}
+
+// RoundMessage reports how a round of a simultaneous game was resolved
+type RoundMessage struct {
+	Type string `json:"type"`
+	engine.Round
+}
+
+// submitMove takes a player's move in a simultaneous game and, once both
+// players have moved, resolves the round. Must be called with room.mu held.
+func (room *Room) submitMove(ws *websocket.Conn, move engine.Move, playerID int) error {
+	game := room.game
+	if err := game.SubmitMove(move, playerID); err != nil {
+		log.Println(err)
+		sendErrorFor(ws, err)
+		room.logEvent("error", playerID, err.Error())
+		return err
+	}
+	if move.Nonce != "" {
+		game.LastNonce[playerID] = move.Nonce
+	}
+	room.logEvent("submit", playerID, "")
+	for client := range room.clients {
+		if err := writeMessage(client, SubmittedMessage{Type: "move_submitted", Player: playerID}); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+	if game.Pending[0] == nil || game.Pending[1] == nil {
+		return nil
+	}
+
+	round := game.ResolveRound()
+	for i, move := range round.Moves {
+		detail := fmt.Sprintf("%s %s", move.Character, move.Direction)
+		if i < len(round.Moves)-1 {
+			room.logEvent("move", move.Player, detail)
+		} else {
+			room.logMove(move.Player, detail)
+		}
+	}
+	room.moveApplied()
+	room.broadcastRound(RoundMessage{Type: "round", Round: round})
+	room.scheduleBroadcast()
+	return nil
+}
+
+// broadcastRound sends every client how a round was resolved, in their own
+// orientation. Spectators the history is hidden from are only told once the
+// game is over, through its transcript. Must be called with room.mu held.
+func (room *Room) broadcastRound(round RoundMessage) {
+	height := len(room.game.Board)
+	for client, id := range room.clients {
+		if id == spectator && config.HideHistory && !room.game.GameOver {
+			continue
+		}
+		msg := round
+		if room.viewFlipped(client, id) {
+			msg.Moves = make([]engine.MoveRecord, len(round.Moves))
+			for i, move := range round.Moves {
+				msg.Moves[i] = flipMove(move, height)
+			}
+			msg.Dropped = make([]engine.DroppedMove, len(round.Dropped))
+			for i, dropped := range round.Dropped {
+				dropped.Direction = flipDirection(dropped.Direction)
+				msg.Dropped[i] = dropped
+			}
+		}
+		send := writeMessage
+		if id == spectator && config.SpectatorDelay > 0 {
+			send = room.sendDelayed
+		}
+		if err := send(client, msg); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+}
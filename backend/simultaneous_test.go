@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestSimultaneousRoom(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.Simultaneous = true })
+	p0, p1 := startGame(t, srv, "room=a")
+
+	// Player 1 moves before player 0, and player 0 is only told that it has
+	p1.move("P1", "F")
+	var submitted SubmittedMessage
+	p0.expect("move_submitted", &submitted)
+	if submitted.Player != 1 {
+		t.Fatalf("got a submission from player %d, want 1", submitted.Player)
+	}
+	p0.move("P1", "B")
+
+	var round RoundMessage
+	p1.expect("round", &round)
+	if round.Priority != 0 || len(round.Moves) != 2 || round.Moves[0].Player != 0 {
+		t.Fatalf("got round %+v, want both moves played, player 0's first", round.Round)
+	}
+	if state := p1.expectState(2); len(state.Submitted) != 0 || state.CurrentPlayer != 1 {
+		t.Fatalf("state after the round has submissions %v and player %d with priority", state.Submitted, state.CurrentPlayer)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// GameStartMessage announces that a game has begun, with everything a client
+// needs to set it up: who is playing, who moves first and the rules in force
+type GameStartMessage struct {
+	Type        string         `json:"type"`
+	Room        string         `json:"room"`
+	Players     [2]StartPlayer `json:"players"`
+	FirstPlayer int            `json:"first_player"`
+	Options     RoomOptions    `json:"options"`
+	Variant     Variant        `json:"variant"`
+	Match       *Match         `json:"match,omitempty"`
+}
+
+// StartPlayer identifies a player in a GameStartMessage
+type StartPlayer struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	UserID string `json:"user_id,omitempty"`
+}
+
+// Variant lists the configured rules that change how the game is played
+type Variant struct {
+	King             string   `json:"king,omitempty"`
+	KingSafety       bool     `json:"king_safety"`
+	NonCapturing     []string `json:"non_capturing,omitempty"`
+	HeroPush         bool     `json:"hero_push"`
+	Guarding         bool     `json:"guarding"`
+	RespawnTurns     int      `json:"respawn_turns"`
+	AllowSwap        bool     `json:"allow_swap"`
+	AllowPass        bool     `json:"allow_pass"`
+	MaxMoves         int      `json:"max_moves"`
+	CaptureTiebreak  bool     `json:"capture_tiebreak"`
+	ImmobilizedLoses bool     `json:"immobilized_loses"`
+	TouchMove        bool     `json:"touch_move"`
+	NoTakeback       bool     `json:"no_takeback"`
+	Strict           bool     `json:"strict"`
+}
+
+// currentVariant returns the rules the server is configured with
+func currentVariant() Variant {
+	return Variant{
+		King:             config.King,
+		KingSafety:       config.KingSafety,
+		NonCapturing:     config.NonCapturing,
+		HeroPush:         config.HeroPush,
+		Guarding:         config.Guarding,
+		RespawnTurns:     config.RespawnTurns,
+		AllowSwap:        config.AllowSwap,
+		AllowPass:        config.AllowPass,
+		MaxMoves:         config.MaxMoves,
+		CaptureTiebreak:  config.CaptureTiebreak,
+		ImmobilizedLoses: config.ImmobilizedLoses,
+		TouchMove:        config.TouchMove,
+		NoTakeback:       config.NoTakeback,
+		Strict:           config.Strict,
+	}
+}
+
+// broadcastGameStart sends every client the start of the room's game.
+// Spectators don't learn who is playing if identities are hidden, and see the
+// start after the spectator delay. Must be called with room.mu held.
+func (room *Room) broadcastGameStart() {
+	msg := GameStartMessage{
+		Type:        "game_start",
+		Room:        room.ID,
+		FirstPlayer: room.game.FirstPlayer,
+		Options:     room.options,
+		Variant:     currentVariant(),
+		Match:       room.match,
+	}
+	for i, player := range room.game.Players {
+		msg.Players[i] = StartPlayer{ID: player.ID, Name: player.Name, UserID: player.UserID}
+	}
+
+	for client, id := range room.clients {
+		send := writeMessage
+		if id == spectator && config.SpectatorDelay > 0 {
+			send = room.sendDelayed
+		}
+		clientMsg := msg
+		if id == spectator && config.HideIdentities {
+			for i := range clientMsg.Players {
+				clientMsg.Players[i] = StartPlayer{ID: i, Name: fmt.Sprintf("Player %d", i+1)}
+			}
+		}
+		if err := send(client, clientMsg); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+}
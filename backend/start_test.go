@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestGameStartMessage(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) {
+		c.AllowPass = true
+		c.HideIdentities = true
+	})
+	alice, bob := dial(t, srv, "room=a&user=alice"), dial(t, srv, "room=a&user=bob")
+	watcher := dial(t, srv, "room=a")
+	for _, client := range []*testClient{alice, bob, watcher} {
+		client.expect("state", nil)
+	}
+	alice.send(Message{Action: "ready"})
+	bob.send(Message{Action: "ready"})
+
+	var start GameStartMessage
+	bob.expect("game_start", &start)
+	if start.Room != "a" || start.FirstPlayer != 0 || start.Players[0].UserID != "alice" || start.Players[1].UserID != "bob" {
+		t.Fatalf("got game start %+v", start)
+	}
+	if !start.Variant.AllowPass || start.Options.BoardWidth != 5 {
+		t.Fatalf("game start announces variant %+v and options %+v", start.Variant, start.Options)
+	}
+
+	var watched GameStartMessage
+	watcher.expect("game_start", &watched)
+	if watched.Players[0].UserID != "" || watched.Players[0].Name != "Player 1" {
+		t.Fatalf("spectator sees player 0 as %+v", watched.Players[0])
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"hitwicket/engine"
+)
+
+// statsTTL is how long /stats serves the same figures before recomputing them
+const statsTTL = 10 * time.Second
+
+// Stats sums up every game in the store
+type Stats struct {
+	GamesPlayed  int     `json:"games_played"`
+	AverageMoves float64 `json:"average_moves"`
+	// WinningPiece is the piece type that most often made the last move of
+	// a won game
+	WinningPiece string `json:"winning_piece,omitempty"`
+	// FirstPlayerWinRate is the share of won games won by the player who
+	// moved first
+	FirstPlayerWinRate float64 `json:"first_player_win_rate"`
+}
+
+var statsCache struct {
+	mu    sync.Mutex
+	at    time.Time
+	stats Stats
+}
+
+// computeStats works out the stats of a list of finished games
+func computeStats(records []GameRecord) Stats {
+	stats := Stats{GamesPlayed: len(records)}
+	moves, won, firstWins := 0, 0, 0
+	winningPieces := make(map[string]int)
+	for _, record := range records {
+		moves += len(record.Moves)
+		if record.Winner == engine.NoWinner {
+			continue
+		}
+		won++
+		if record.Winner == record.FirstPlayer {
+			firstWins++
+		}
+		if n := len(record.Moves); n > 0 && record.Moves[n-1].Player == record.Winner && record.Moves[n-1].Piece != "" {
+			winningPieces[record.Moves[n-1].Piece]++
+		}
+	}
+	if len(records) > 0 {
+		stats.AverageMoves = float64(moves) / float64(len(records))
+	}
+	if won > 0 {
+		stats.FirstPlayerWinRate = float64(firstWins) / float64(won)
+	}
+	for piece, n := range winningPieces {
+		best := winningPieces[stats.WinningPiece]
+		if n > best || (n == best && piece < stats.WinningPiece) {
+			stats.WinningPiece = piece
+		}
+	}
+	return stats
+}
+
+// handleStats serves the stats of every finished game as JSON, recomputing
+// them at most once per statsTTL
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	statsCache.mu.Lock()
+	if time.Since(statsCache.at) >= statsTTL {
+		records, err := store.ListGames()
+		if err != nil {
+			statsCache.mu.Unlock()
+			log.Printf("error: %v", err)
+			http.Error(w, "could not read the games", http.StatusInternalServerError)
+			return
+		}
+		statsCache.stats = computeStats(records)
+		statsCache.at = time.Now()
+	}
+	stats := statsCache.stats
+	statsCache.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
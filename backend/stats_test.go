@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"hitwicket/engine"
+)
+
+func TestComputeStats(t *testing.T) {
+	records := []GameRecord{
+		{Winner: 0, FirstPlayer: 0, Moves: []engine.MoveRecord{{Player: 0, Piece: "Hero1"}}},
+		{Winner: 1, FirstPlayer: 0, Moves: []engine.MoveRecord{{Player: 0, Piece: "Pawn"}, {Player: 1, Piece: "Pawn"}}},
+		{Winner: 0, FirstPlayer: 1, Moves: []engine.MoveRecord{{Player: 1, Piece: "Pawn"}, {Player: 0, Piece: "Hero1"}, {Player: 1, Piece: "Pawn"}}},
+		{Winner: engine.NoWinner, Moves: []engine.MoveRecord{{Player: 0, Piece: "Pawn"}, {Player: 1, Piece: "Pawn"}}},
+	}
+	stats := computeStats(records)
+	want := Stats{GamesPlayed: 4, AverageMoves: 2, WinningPiece: "Hero1", FirstPlayerWinRate: 1.0 / 3}
+	if stats != want {
+		t.Fatalf("got stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, _ := startGame(t, srv, "room=a")
+	p0.move("H2", "B")
+	p0.expectState(1)
+	p0.send(Message{Action: "resign"})
+	for !p0.expectState(1).GameOver {
+	}
+
+	var stats Stats
+	getJSON(t, srv.URL+"/stats", &stats)
+	if stats.GamesPlayed != 1 || stats.AverageMoves != 1 || stats.FirstPlayerWinRate != 0 {
+		t.Fatalf("got stats %+v, want one game of one move won by the second player", stats)
+	}
+}
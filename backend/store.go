@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"hitwicket/engine"
+)
+
+// ErrGameNotFound is returned by a Store asked for a game it doesn't hold
+var ErrGameNotFound = errors.New("game not found")
+
+// GameRecord is a finished game as it is kept by a Store
+type GameRecord struct {
+	ID          string                    `json:"id"`
+	Room        string                    `json:"room"`
+	Players     [2]string                 `json:"players"`
+	UserIDs     [2]string                 `json:"user_ids"`
+	FirstPlayer int                       `json:"first_player"`
+	Winner      int                       `json:"winner"`
+	Reason      string                    `json:"reason"`
+	Result      string                    `json:"result"`
+	Start       [2][]engine.Character     `json:"start"`
+	Moves       []engine.MoveRecord       `json:"moves"`
+	Captures    [2][]engine.CapturedPiece `json:"captures"`
+	Options     RoomOptions               `json:"options"`
+	Finished    time.Time                 `json:"finished"`
+}
+
+// Store keeps finished games and the standings of the users who played them
+type Store interface {
+	SaveGame(record GameRecord) error
+	LoadGame(id string) (GameRecord, error)
+	// ListGames returns every game, oldest first
+	ListGames() ([]GameRecord, error)
+	// UpdateStats adds a finished game to its players' standings. Players
+	// without a user ID aren't tracked.
+	UpdateStats(record GameRecord) error
+	Stats() ([]Standing, error)
+	// AppendMoves keeps moves trimmed from the history of a game still
+	// being played, after any kept for it before, until TakeMoves collects
+	// them once it is over
+	AppendMoves(gameID string, moves []engine.MoveRecord) error
+	TakeMoves(gameID string) ([]engine.MoveRecord, error)
+}
+
+// store is where the server keeps finished games
+var store Store = newMemoryStore()
+
+// openStore returns the store the config selects
+func openStore(c *Config) (Store, error) {
+	switch c.Store {
+	case "memory":
+		return newMemoryStore(), nil
+	case "file":
+		return newFileStore(c.StoreDir)
+	}
+	return nil, fmt.Errorf("unknown store: %s", c.Store)
+}
+
+// addResult counts a game in its players' standings
+func addResult(standings map[string]*Standing, record GameRecord) {
+	for playerID, userID := range record.UserIDs {
+		if userID == "" {
+			continue
+		}
+		standing, ok := standings[userID]
+		if !ok {
+			standing = &Standing{UserID: userID}
+			standings[userID] = standing
+		}
+		switch record.Winner {
+		case engine.NoWinner:
+			standing.Draws++
+		case playerID:
+			standing.Wins++
+		default:
+			standing.Losses++
+		}
+	}
+}
+
+// memoryStore keeps everything in memory, losing it when the server stops
+type memoryStore struct {
+	mu        sync.Mutex
+	games     map[string]GameRecord
+	order     []string
+	standings map[string]*Standing
+	moves     map[string][]engine.MoveRecord
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		games:     make(map[string]GameRecord),
+		standings: make(map[string]*Standing),
+		moves:     make(map[string][]engine.MoveRecord),
+	}
+}
+
+func (s *memoryStore) SaveGame(record GameRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.games[record.ID]; !ok {
+		s.order = append(s.order, record.ID)
+	}
+	s.games[record.ID] = record
+	return nil
+}
+
+func (s *memoryStore) LoadGame(id string) (GameRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.games[id]
+	if !ok {
+		return GameRecord{}, fmt.Errorf("%w: %s", ErrGameNotFound, id)
+	}
+	return record, nil
+}
+
+func (s *memoryStore) ListGames() ([]GameRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]GameRecord, 0, len(s.order))
+	for _, id := range s.order {
+		records = append(records, s.games[id])
+	}
+	return records, nil
+}
+
+func (s *memoryStore) UpdateStats(record GameRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addResult(s.standings, record)
+	return nil
+}
+
+func (s *memoryStore) Stats() ([]Standing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortStandings(s.standings), nil
+}
+
+func (s *memoryStore) AppendMoves(gameID string, moves []engine.MoveRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.moves[gameID] = append(s.moves[gameID], moves...)
+	return nil
+}
+
+func (s *memoryStore) TakeMoves(gameID string) ([]engine.MoveRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	moves := s.moves[gameID]
+	delete(s.moves, gameID)
+	return moves, nil
+}
+
+// fileStore keeps each game as a JSON file in a games directory and the
+// standings in standings.json, all under one directory. The moves trimmed
+// from games still being played are appended a line at a time to a file
+// per game in a moves directory.
+type fileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newFileStore(dir string) (*fileStore, error) {
+	for _, sub := range []string{"games", "moves"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) gamePath(id string) string {
+	return filepath.Join(s.dir, "games", id+".json")
+}
+
+func (s *fileStore) movesPath(gameID string) string {
+	return filepath.Join(s.dir, "moves", gameID+".jsonl")
+}
+
+func (s *fileStore) SaveGame(record GameRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFileAtomic(s.gamePath(record.ID), data)
+}
+
+func (s *fileStore) LoadGame(id string) (GameRecord, error) {
+	if id == "" || filepath.Base(id) != id {
+		return GameRecord{}, fmt.Errorf("%w: %s", ErrGameNotFound, id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.gamePath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return GameRecord{}, fmt.Errorf("%w: %s", ErrGameNotFound, id)
+	}
+	if err != nil {
+		return GameRecord{}, err
+	}
+	var record GameRecord
+	err = json.Unmarshal(data, &record)
+	return record, err
+}
+
+func (s *fileStore) ListGames() ([]GameRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths, err := filepath.Glob(filepath.Join(s.dir, "games", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]GameRecord, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var record GameRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		records = append(records, record)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Finished.Before(records[j].Finished)
+	})
+	return records, nil
+}
+
+func (s *fileStore) UpdateStats(record GameRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	standings, err := s.readStandings()
+	if err != nil {
+		return err
+	}
+	addResult(standings, record)
+	data, err := json.Marshal(sortStandings(standings))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, "standings.json"), data)
+}
+
+func (s *fileStore) Stats() ([]Standing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	standings, err := s.readStandings()
+	if err != nil {
+		return nil, err
+	}
+	return sortStandings(standings), nil
+}
+
+func (s *fileStore) AppendMoves(gameID string, moves []engine.MoveRecord) error {
+	var data []byte
+	for _, move := range moves {
+		line, err := json.Marshal(move)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.movesPath(gameID), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *fileStore) TakeMoves(gameID string) ([]engine.MoveRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := s.movesPath(gameID)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var moves []engine.MoveRecord
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var move engine.MoveRecord
+		if err := json.Unmarshal(line, &move); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		moves = append(moves, move)
+	}
+	return moves, os.Remove(path)
+}
+
+// writeFileAtomic replaces a file's contents by writing them to a temporary
+// file beside it and renaming that over it, so that a server stopped partway
+// through leaves the old contents rather than a truncated file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readStandings loads the standings file. A missing file means no standings.
+// Must be called with s.mu held.
+func (s *fileStore) readStandings() (map[string]*Standing, error) {
+	standings := make(map[string]*Standing)
+	data, err := os.ReadFile(filepath.Join(s.dir, "standings.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return standings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Standing
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for i := range list {
+		standings[list[i].UserID] = &list[i]
+	}
+	return standings, nil
+}
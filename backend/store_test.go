@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"hitwicket/engine"
+)
+
+// testStores returns a memory store and a file store in a temporary
+// directory, each empty
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	files, err := newFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"memory": newMemoryStore(), "file": files}
+}
+
+func TestStoreGames(t *testing.T) {
+	finished := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			later := GameRecord{ID: "b", Winner: 1, Result: "0-1", Finished: finished.Add(time.Minute)}
+			earlier := GameRecord{
+				ID:       "a",
+				UserIDs:  [2]string{"alice", "bob"},
+				Winner:   engine.NoWinner,
+				Result:   "1/2-1/2",
+				Moves:    []engine.MoveRecord{{Player: 0, Character: "P1", Direction: "B"}},
+				Finished: finished,
+			}
+			for _, record := range []GameRecord{earlier, later} {
+				if err := s.SaveGame(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := s.LoadGame("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Result != "1/2-1/2" || len(got.Moves) != 1 || got.Moves[0].Character != "P1" || !got.Finished.Equal(finished) {
+				t.Fatalf("loaded %+v", got)
+			}
+			games, err := s.ListGames()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, game := range games {
+				ids = append(ids, game.ID)
+			}
+			if !slices.Equal(ids, []string{"a", "b"}) {
+				t.Fatalf("listed games %v, want the oldest first", ids)
+			}
+			for _, id := range []string{"missing", "../a"} {
+				if _, err := s.LoadGame(id); !errors.Is(err, ErrGameNotFound) {
+					t.Errorf("loading %q: got %v, want %v", id, err, ErrGameNotFound)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreStats(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			records := []GameRecord{
+				{UserIDs: [2]string{"alice", "bob"}, Winner: 0},
+				{UserIDs: [2]string{"bob", "alice"}, Winner: engine.NoWinner},
+				{UserIDs: [2]string{"alice", ""}, Winner: 1},
+			}
+			for _, record := range records {
+				if err := s.UpdateStats(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			board, err := s.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []Standing{{UserID: "alice", Wins: 1, Losses: 1, Draws: 1}, {UserID: "bob", Losses: 1, Draws: 1}}
+			if !slices.Equal(board, want) {
+				t.Fatalf("got standings %+v, want %+v", board, want)
+			}
+		})
+	}
+}
+
+func TestStandingsSurviveRestart(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Store, cfg.StoreDir = "file", t.TempDir()
+	s, err := openStore(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Games finishing at once are all counted
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.UpdateStats(GameRecord{UserIDs: [2]string{"alice", "bob"}, Winner: i % 2}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	reopened, err := openStore(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	board, err := reopened.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Standing{{UserID: "alice", Wins: 10, Losses: 10}, {UserID: "bob", Wins: 10, Losses: 10}}
+	if !slices.Equal(board, want) {
+		t.Fatalf("standings after reopening the store %+v, want %+v", board, want)
+	}
+	if leftover, _ := filepath.Glob(filepath.Join(cfg.StoreDir, "*.tmp")); len(leftover) > 0 {
+		t.Errorf("writes left temporary files %v", leftover)
+	}
+}
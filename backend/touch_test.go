@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"hitwicket/engine"
+)
+
+func TestTouchMove(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) { c.TouchMove = true })
+	p0, _ := startGame(t, srv, "room=a")
+
+	// The first piece touched binds the player, whatever they touch after
+	p0.send(Message{Action: "select", Move: engine.Move{CharacterName: "P1"}})
+	p0.send(Message{Action: "select", Move: engine.Move{CharacterName: "P3"}})
+	p0.move("P3", "B")
+	if code := p0.expectError().Code; code != engine.ErrorCode(engine.ErrTouchMove) {
+		t.Fatalf("moving another piece than the one touched got code %q", code)
+	}
+	p0.move("P1", "B")
+	p0.expectState(1)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gorilla/websocket"
+	"hitwicket/engine"
+)
+
+// TraceMessage explains to a connection in debug mode why its move was
+// rejected, step by step
+type TraceMessage struct {
+	Type  string   `json:"type"`
+	Error string   `json:"error"`
+	Steps []string `json:"steps"`
+}
+
+// sendTrace replays the validation of a rejected move and sends the client
+// each check that was made. It only reads the game. Must be called with
+// room.mu held.
+func (room *Room) sendTrace(ws *websocket.Conn, move engine.Move, playerID int, moveErr error) {
+	game := room.game
+	steps := make([]string, 0)
+	trace := func(format string, args ...any) {
+		steps = append(steps, fmt.Sprintf(format, args...))
+	}
+
+	direction, ok := normalizeDirection(move.Direction)
+	switch {
+	case !ok:
+		trace("%q is not a direction or a configured alias", move.Direction)
+	case game.FindCharacter(move.CharacterName, playerID) == nil:
+		trace("player %d has no piece named %q", playerID, move.CharacterName)
+	default:
+		if direction != move.Direction {
+			trace("%q is an alias for %s", move.Direction, direction)
+		}
+		if isFlipped(playerID) {
+			trace("%s on the mirrored board is %s on the board", direction, flipDirection(direction))
+			direction = flipDirection(direction)
+		}
+		game.CheckMove(game.FindCharacter(move.CharacterName, playerID), direction, trace)
+	}
+
+	err := writeMessage(ws, TraceMessage{Type: "trace", Error: moveErr.Error(), Steps: steps})
+	if err != nil {
+		log.Printf("error: %v", err)
+	}
+}
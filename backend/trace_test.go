@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestTraceOfRejectedMove(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, _ := startGameWith(t, srv, "room=a&debug=true", "room=a")
+	p0.move("P1", "up")
+	p0.expectState(0)
+	var msg TraceMessage
+	p0.expect("trace", &msg)
+	if msg.Error == "" || len(msg.Steps) < 2 || msg.Steps[0] != `"up" is an alias for F` {
+		t.Fatalf("got trace %+v", msg)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// handleRoomTranscript serves the transcript of a room's current game as
+// plain text. If the history is hidden from spectators, it isn't served until
+// the game is over.
+func handleRoomTranscript(w http.ResponseWriter, r *http.Request) {
+	room := findRoom(r.PathValue("id"))
+	if room == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	room.mu.Lock()
+	hidden := config.HideHistory && !room.game.GameOver
+	transcript := room.game.Transcript(room.ID)
+	room.mu.Unlock()
+	if hidden {
+		http.Error(w, "the move history is hidden until the game is over", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write([]byte(transcript)); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
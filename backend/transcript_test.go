@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRoomTranscript(t *testing.T) {
+	srv := newTestServer(t, nil)
+	p0, _ := startGame(t, srv, "room=a")
+	p0.move("P1", "B")
+	p0.expectState(1)
+
+	resp, err := http.Get(srv.URL + "/rooms/a/transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("got %s with content type %q", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "1. P1-B *") {
+		t.Errorf("transcript doesn't show the move:\n%s", body)
+	}
+}
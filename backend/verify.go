@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+
+	"hitwicket/engine"
+)
+
+// maxVerifyBody is the largest game submission /verify-game reads
+const maxVerifyBody = 1 << 20
+
+// VerifyRequest is a complete game submitted for review: each player's
+// starting arrangement, the moves in the order they were played and, if
+// given, the result the players declared
+type VerifyRequest struct {
+	Setup       [2][]engine.SetupPiece `json:"setup"`
+	FirstPlayer int                    `json:"first_player"`
+	// Moves use the client message format: a move, or a swap or pass
+	// action, always in board orientation
+	Moves  []Message `json:"moves"`
+	Result string    `json:"result,omitempty"`
+}
+
+// VerifiedMove is the replay's verdict on one submitted move
+type VerifiedMove struct {
+	Index  int    `json:"index"`
+	Player int    `json:"player"`
+	Valid  bool   `json:"valid"`
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+// VerifyResponse reports the replay of a submitted game. Moves stops at the
+// first illegal move. Valid is set only if every move was legal and the
+// declared result, if any, matches the one the replay reached.
+type VerifyResponse struct {
+	Valid         bool           `json:"valid"`
+	Moves         []VerifiedMove `json:"moves"`
+	Result        string         `json:"result"`
+	Reason        string         `json:"reason,omitempty"`
+	ResultMatches bool           `json:"result_matches"`
+}
+
+// verifyGame replays a submitted game from its starting position under the
+// server's rules. Without a setup, a player starts from the arrangement
+// NewGame deals with the configured seed.
+func verifyGame(req VerifyRequest) (VerifyResponse, error) {
+	if req.FirstPlayer != 0 && req.FirstPlayer != 1 {
+		return VerifyResponse{}, fmt.Errorf("first player must be 0 or 1, not %d", req.FirstPlayer)
+	}
+	game := engine.NewGame(rand.New(rand.NewSource(config.Seed)), config.roomOptions().rules())
+	for playerID, pieces := range req.Setup {
+		if pieces == nil {
+			continue
+		}
+		if err := game.ApplySetup(playerID, pieces); err != nil {
+			return VerifyResponse{}, fmt.Errorf("setup of player %d: %w", playerID, err)
+		}
+	}
+	game.FirstPlayer = req.FirstPlayer
+	game.CurrentPlayer = req.FirstPlayer
+	game.Ready = [2]bool{true, true}
+	game.Started = true
+
+	resp := VerifyResponse{Valid: true, Moves: make([]VerifiedMove, 0, len(req.Moves))}
+	for i, msg := range req.Moves {
+		verdict := VerifiedMove{Index: i, Player: game.CurrentPlayer, Valid: true}
+		if err := replay(game, msg); err != nil {
+			verdict.Valid = false
+			verdict.Error = err.Error()
+			verdict.Code = engine.ErrorCode(err)
+			resp.Valid = false
+		}
+		resp.Moves = append(resp.Moves, verdict)
+		if !verdict.Valid {
+			break
+		}
+	}
+
+	resp.Result = game.Result()
+	resp.Reason = game.GameOverReason
+	resp.ResultMatches = req.Result == "" || req.Result == resp.Result
+	resp.Valid = resp.Valid && resp.ResultMatches
+	return resp, nil
+}
+
+// replay applies one submitted move for the player to move
+func replay(g *engine.Game, msg Message) error {
+	if g.GameOver {
+		return engine.ErrGameOver
+	}
+	playerID := g.CurrentPlayer
+	switch msg.Action {
+	case "":
+		direction, ok := normalizeDirection(msg.Direction)
+		if !ok {
+			return fmt.Errorf("%w: %s", engine.ErrUnknownDirection, msg.Direction)
+		}
+		msg.Direction = direction
+		return g.ProcessMove(msg.Move, playerID)
+	case "swap":
+		return g.ProcessSwap(msg.A, msg.B, playerID)
+	case "pass":
+		return g.ProcessPass(playerID)
+	}
+	return fmt.Errorf("unknown action: %s", msg.Action)
+}
+
+// handleVerifyGame replays a game posted as a VerifyRequest and reports
+// whether it was played legally
+func handleVerifyGame(w http.ResponseWriter, r *http.Request) {
+	var req VerifyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxVerifyBody)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid game: %v", err), http.StatusBadRequest)
+		return
+	}
+	resp, err := verifyGame(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid game: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hitwicket/engine"
+)
+
+// postVerify submits a game to /verify-game, returning the response status
+// and the decoded report if the game was accepted for review
+func postVerify(t *testing.T, srv *httptest.Server, body []byte) (int, VerifyResponse) {
+	t.Helper()
+	resp, err := http.Post(srv.URL+"/verify-game", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var report VerifyResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, report
+}
+
+func TestVerifyGame(t *testing.T) {
+	srv := newTestServer(t, nil)
+	moves := []Message{
+		{Move: engine.Move{CharacterName: "P1", Direction: "B"}},
+		{Move: engine.Move{CharacterName: "P1", Direction: "forward"}},
+	}
+	body, _ := json.Marshal(VerifyRequest{Moves: moves, Result: "*"})
+	status, report := postVerify(t, srv, body)
+	if status != http.StatusOK || !report.Valid || len(report.Moves) != 2 || report.Moves[1].Player != 1 {
+		t.Fatalf("legal game got %d %+v", status, report)
+	}
+
+	// The replay stops at the first illegal move
+	moves = append(moves, Message{Move: engine.Move{CharacterName: "P1", Direction: "L"}}, moves[0])
+	body, _ = json.Marshal(VerifyRequest{Moves: moves})
+	_, report = postVerify(t, srv, body)
+	if report.Valid || len(report.Moves) != 3 || report.Moves[2].Valid || report.Moves[2].Code != "out_of_bounds" {
+		t.Fatalf("game with an illegal third move got %+v", report)
+	}
+
+	body, _ = json.Marshal(VerifyRequest{Moves: moves[:2], Result: "1-0"})
+	if _, report = postVerify(t, srv, body); report.Valid || report.ResultMatches {
+		t.Fatalf("game declared won that isn't over got %+v", report)
+	}
+}
+
+func TestVerifyGameMalformed(t *testing.T) {
+	srv := newTestServer(t, nil)
+	if status, _ := postVerify(t, srv, []byte(`{"moves": 3}`)); status != http.StatusBadRequest {
+		t.Fatalf("malformed submission got %d, want 400", status)
+	}
+	if status, _ := postVerify(t, srv, []byte(`{"first_player": 2}`)); status != http.StatusBadRequest {
+		t.Fatalf("submission with player 2 moving first got %d, want 400", status)
+	}
+}
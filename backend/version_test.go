@@ -0,0 +1,16 @@
+package main
+
+import (
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	srv := newTestServer(t, nil)
+	var info VersionInfo
+	getJSON(t, srv.URL+"/version", &info)
+	if info.Version != version || info.GoVersion != runtime.Version() || !slices.Equal(info.Protocols, subprotocols) {
+		t.Fatalf("got version info %+v", info)
+	}
+}